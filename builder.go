@@ -21,6 +21,9 @@ type RequestBuilder struct {
 	dataMimeType string
 	tpUrl        string
 	tpOpts       []rsocket.TransportOpts
+	onClose      []func(error)
+	codecs       *internal.CodecRegistry
+	interceptors []spi.Interceptor
 }
 
 func (b *RequestBuilder) ConnectTCP(host string, port int, opts ...rsocket.TransportOpts) *RequestBuilder {
@@ -30,9 +33,15 @@ func (b *RequestBuilder) ConnectTCP(host string, port int, opts ...rsocket.Trans
 }
 
 func (b *RequestBuilder) Build(ctx context.Context) (requester spi.Requester, err error) {
-	data, err := internal.MarshalWithMimeType(b.setupData, b.dataMimeType)
-	if err != nil {
-		return
+	if b.codecs == nil {
+		b.codecs = internal.DefaultCodecRegistry
+	}
+	var data []byte
+	if b.setupData != nil {
+		data, err = b.codecs.Marshal(b.setupData, b.dataMimeType)
+		if err != nil {
+			return
+		}
 	}
 	var metadata []byte
 	if len(b.setupMeta) > 0 {
@@ -47,22 +56,27 @@ func (b *RequestBuilder) Build(ctx context.Context) (requester spi.Requester, er
 	}
 
 	setup := payload.New(data, metadata)
-	rs, err := rsocket.Connect().
+	cb := rsocket.Connect().
 		MetadataMimeType(extension.MessageCompositeMetadata.String()).
 		DataMimeType(b.dataMimeType).
-		SetupPayload(setup).
+		SetupPayload(setup)
+	for _, it := range b.onClose {
+		cb = cb.OnClose(it)
+	}
+	rs, err := cb.
 		Transport(b.tpUrl, b.tpOpts...).
 		Start(ctx)
 	if err != nil {
 		return
 	}
-	requester = internal.NewRequester(rs, b.dataMimeType)
+	requester = internal.NewRequester(rs, b.dataMimeType, b.codecs, b.interceptors...)
 	return
 }
 
+// SetupRoute sets the route of SETUP payload, the template is filled in the same way as spi.Requester.Route.
 func (b *RequestBuilder) SetupRoute(route string, args ...interface{}) *RequestBuilder {
 	b.setupMeta = append(b.setupMeta, func(writer io.Writer) (err error) {
-		r, err := internal.MkString(route, args...)
+		r, err := internal.ExpandRoute(route, args...)
 		if err != nil {
 			return
 		}
@@ -82,11 +96,48 @@ func (b *RequestBuilder) SetupRoute(route string, args ...interface{}) *RequestB
 
 func (b *RequestBuilder) SetupMetadata(metadata interface{}, mimeType string) *RequestBuilder {
 	b.setupMeta = append(b.setupMeta, func(writer io.Writer) (err error) {
-		b, err := internal.MarshalWithMimeType(metadata, mimeType)
+		raw, err := b.codecs.Marshal(metadata, mimeType)
 		if err != nil {
 			return
 		}
-		c, err := extension.NewCompositeMetadataBuilder().Push(mimeType, b).Build()
+		c, err := extension.NewCompositeMetadataBuilder().Push(mimeType, raw).Build()
+		if err != nil {
+			return
+		}
+		_, err = writer.Write(c)
+		return
+	})
+	return b
+}
+
+// SetupAuth adds a message/x.rsocket.authentication.v0 entry with a custom auth type to the setup metadata.
+func (b *RequestBuilder) SetupAuth(authType string, payload []byte) *RequestBuilder {
+	return b.setupAuth(func() ([]byte, error) {
+		return internal.EncodeAuth(authType, payload)
+	})
+}
+
+// SetupAuthSimple adds a message/x.rsocket.authentication.v0 entry with simple auth type to the setup metadata.
+func (b *RequestBuilder) SetupAuthSimple(username, password string) *RequestBuilder {
+	return b.setupAuth(func() ([]byte, error) {
+		return internal.EncodeSimpleAuth(username, password)
+	})
+}
+
+// SetupAuthBearer adds a message/x.rsocket.authentication.v0 entry with bearer auth type to the setup metadata.
+func (b *RequestBuilder) SetupAuthBearer(token string) *RequestBuilder {
+	return b.setupAuth(func() ([]byte, error) {
+		return internal.EncodeBearerAuth(token)
+	})
+}
+
+func (b *RequestBuilder) setupAuth(encode func() ([]byte, error)) *RequestBuilder {
+	b.setupMeta = append(b.setupMeta, func(writer io.Writer) (err error) {
+		raw, err := encode()
+		if err != nil {
+			return
+		}
+		c, err := extension.NewCompositeMetadataBuilder().PushWellKnown(extension.MessageAuthentication, raw).Build()
 		if err != nil {
 			return
 		}
@@ -101,6 +152,32 @@ func (b *RequestBuilder) DataMimeType(mimeType string) *RequestBuilder {
 	return b
 }
 
+// OnClose registers a callback which will be invoked when the connection is closed, a rejected setup will be passed as
+// the error.
+func (b *RequestBuilder) OnClose(fn func(error)) *RequestBuilder {
+	if fn != nil {
+		b.onClose = append(b.onClose, fn)
+	}
+	return b
+}
+
+// Interceptor appends interceptors for all requests of the requester, they are invoked in order.
+// The setup payload is not intercepted.
+func (b *RequestBuilder) Interceptor(interceptors ...spi.Interceptor) *RequestBuilder {
+	for _, it := range interceptors {
+		if it != nil {
+			b.interceptors = append(b.interceptors, it)
+		}
+	}
+	return b
+}
+
+// CodecRegistry sets the codecs used by the requester instead of the default registry.
+func (b *RequestBuilder) CodecRegistry(codecs *CodecRegistry) *RequestBuilder {
+	b.codecs = codecs
+	return b
+}
+
 func (b *RequestBuilder) SetupData(data interface{}) *RequestBuilder {
 	b.setupData = data
 	return b
@@ -109,5 +186,6 @@ func (b *RequestBuilder) SetupData(data interface{}) *RequestBuilder {
 func Builder() *RequestBuilder {
 	return &RequestBuilder{
 		dataMimeType: extension.ApplicationJSON.String(),
+		codecs:       internal.DefaultCodecRegistry,
 	}
 }
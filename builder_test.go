@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/jjeffcaii/rsocket-messaging-go"
 	"github.com/jjeffcaii/rsocket-messaging-go/spi"
@@ -20,11 +21,49 @@ func (s Student) String() string {
 	return fmt.Sprintf("Student{ID=%d,Name=%s,Birth=%s}", s.ID, s.Name, s.Birth)
 }
 
+// newStudentRouter creates a router which works like StudentController.java.
+func newStudentRouter() *messaging.Router {
+	type result struct {
+		Code    int         `json:"code"`
+		Message string      `json:"message"`
+		Data    interface{} `json:"data"`
+	}
+	router := messaging.NewRouter()
+	_ = router.Handle("student.v1.upsert", func(student Student) result {
+		student.ID = int(time.Now().Unix())
+		return result{Data: student}
+	})
+	_ = router.Handle("student.v1.noop.{txt}", func(txt string) {
+		fmt.Println("---> noop:", txt)
+	})
+	_ = router.Handle("student.v1.{id}", func(id int) Student {
+		return Student{ID: id, Name: "foobar", Birth: "2020"}
+	})
+	_ = router.Handle("students.v1", func() <-chan Student {
+		students := make(chan Student)
+		go func() {
+			defer close(students)
+			for i := 0; i < 10; i++ {
+				students <- Student{ID: i, Name: fmt.Sprintf("Foobar%d", i), Birth: time.Now().Format("2006-01-02")}
+			}
+		}()
+		return students
+	})
+	return router
+}
+
 func TestSuite(t *testing.T) {
-	// see: StudentController.java
+	loopback, err := messaging.Server().
+		Router(newStudentRouter()).
+		ServeLoopback(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loopback.Close()
+
 	requester, err := messaging.Builder().
 		DataMimeType("application/json").
-		ConnectTCP("127.0.0.1", 7878).
+		ConnectLoopback(loopback).
 		Build(context.Background())
 	assert.NoError(t, err, "connect failed")
 	defer requester.Close()
@@ -37,7 +76,7 @@ func TestSuite(t *testing.T) {
 
 func testRetrieve(t *testing.T, requester spi.Requester) {
 	err := requester.Route("student.v1.noop.%s", "hello").
-		Metadata("test unknown mime type", "message/x.rsocket.authentication.bearer.v0").
+		AuthBearer("test token").
 		Retrieve()
 	assert.NoError(t, err, "request failed")
 }
@@ -1,9 +1,15 @@
 module github.com/jjeffcaii/rsocket-messaging-go
 
-go 1.14
+go 1.16
 
 require (
+	github.com/fxamacker/cbor/v2 v2.2.0
+	github.com/golang-jwt/jwt/v4 v4.5.2
+	github.com/google/uuid v1.1.1
+	github.com/jjeffcaii/reactor-go v0.1.1
 	github.com/pkg/errors v0.9.1
 	github.com/rsocket/rsocket-go v0.5.9
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.6.1
+	github.com/vmihailenco/msgpack/v5 v5.0.0
+	google.golang.org/protobuf v1.25.0
 )
@@ -0,0 +1,173 @@
+package messaging
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/pkg/errors"
+)
+
+var (
+	_typeContext      = reflect.TypeOf((*context.Context)(nil)).Elem()
+	_typeRouteContext = reflect.TypeOf((*RouteContext)(nil))
+	_typeError        = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type argBinder = func(*RouteContext) (reflect.Value, error)
+
+type reflectHandler struct {
+	fn     reflect.Value
+	args   []argBinder
+	result bool
+	stream bool
+	err    bool
+}
+
+func (h *reflectHandler) handle(c *RouteContext) error {
+	args := make([]reflect.Value, len(h.args))
+	for i, bind := range h.args {
+		v, err := bind(c)
+		if err != nil {
+			return err
+		}
+		args[i] = v
+	}
+	outs := h.fn.Call(args)
+	if h.err {
+		if e := outs[len(outs)-1]; !e.IsNil() {
+			return e.Interface().(error)
+		}
+	}
+	if !h.result {
+		return nil
+	}
+	if h.stream {
+		if outs[0].IsNil() {
+			return nil
+		}
+		return c.RespondStream(outs[0].Interface())
+	}
+	return c.Respond(outs[0].Interface())
+}
+
+// Handle registers a plain function as handler of the path.
+// Arguments are bound by type: context.Context and *RouteContext are injected, the rest are bound to path variables
+// by order, and an extra trailing argument receives the decoded request data.
+// The function can return nothing, an error, a result, or a result and an error. A readable chan result will be
+// sent as a stream.
+func (r *Router) Handle(path string, handler interface{}, middlewares ...Middleware) error {
+	h, err := newReflectHandler(r.path(path), r.table.separators, handler)
+	if err != nil {
+		return err
+	}
+	return r.Route(path, h.handle, middlewares...)
+}
+
+// HandleConnect registers a plain function as connect handler of the path, arguments are bound in the same way as
+// Handle, and results other than an error are ignored.
+func (r *Router) HandleConnect(path string, handler interface{}, middlewares ...Middleware) error {
+	h, err := newReflectHandler(r.path(path), r.table.separators, handler)
+	if err != nil {
+		return err
+	}
+	return r.Connect(path, h.handle, middlewares...)
+}
+
+func newReflectHandler(path, separators string, handler interface{}) (h *reflectHandler, err error) {
+	fn := reflect.ValueOf(handler)
+	if fn.Kind() != reflect.Func {
+		err = errors.Errorf("handler of %s is not a func", path)
+		return
+	}
+	typ := fn.Type()
+	h = &reflectHandler{
+		fn: fn,
+	}
+
+	var bindings []reflect.Type
+	for i := 0; i < typ.NumIn(); i++ {
+		in := typ.In(i)
+		switch in {
+		case _typeContext:
+			h.args = append(h.args, func(c *RouteContext) (reflect.Value, error) {
+				return reflect.ValueOf(c.Context()), nil
+			})
+		case _typeRouteContext:
+			h.args = append(h.args, func(c *RouteContext) (reflect.Value, error) {
+				return reflect.ValueOf(c), nil
+			})
+		default:
+			h.args = append(h.args, nil)
+			bindings = append(bindings, in)
+		}
+	}
+
+	names := internal.ParseVariableNames(path, separators)
+	if len(bindings) != len(names) && len(bindings) != len(names)+1 {
+		err = errors.Errorf("handler of %s requires %d or %d bound arguments, got %d", path, len(names), len(names)+1, len(bindings))
+		return
+	}
+	cur := 0
+	for i := range h.args {
+		if h.args[i] != nil {
+			continue
+		}
+		in := bindings[cur]
+		if cur < len(names) {
+			if !internal.IsConvertible(in) {
+				err = errors.Errorf("cannot bind variable %s of %s to %s", names[cur], path, in)
+				return
+			}
+			h.args[i] = bindVariable(names[cur], in)
+		} else {
+			h.args[i] = bindData(in)
+		}
+		cur++
+	}
+
+	switch typ.NumOut() {
+	case 0:
+	case 1:
+		if typ.Out(0) == _typeError {
+			h.err = true
+		} else {
+			h.result = true
+		}
+	case 2:
+		if typ.Out(1) != _typeError {
+			err = errors.Errorf("the second result of handler %s must be an error", path)
+			return
+		}
+		h.result = true
+		h.err = true
+	default:
+		err = errors.Errorf("too many results of handler %s", path)
+		return
+	}
+	if h.result {
+		out := typ.Out(0)
+		h.stream = out.Kind() == reflect.Chan && out.ChanDir()&reflect.RecvDir != 0
+	}
+	return
+}
+
+func bindVariable(name string, typ reflect.Type) argBinder {
+	return func(c *RouteContext) (reflect.Value, error) {
+		return c.convertVariable(name, typ)
+	}
+}
+
+func bindData(typ reflect.Type) argBinder {
+	return func(c *RouteContext) (value reflect.Value, err error) {
+		ptr := reflect.New(typ)
+		if len(c.Data()) > 0 {
+			if err = c.BindData(ptr.Interface()); err != nil {
+				err = errors.Wrap(err, "bind data failed")
+				return
+			}
+		}
+		value = ptr.Elem()
+		return
+	}
+}
@@ -0,0 +1,102 @@
+package messaging_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_Handle(t *testing.T) {
+	router := messaging.NewRouter()
+	err := router.Handle("student.v1.upsert", func(ctx context.Context, s Student) (Result, error) {
+		assert.NotNil(t, ctx, "context should be injected")
+		s.ID = 1234
+		return Result{Data: s}, nil
+	})
+	assert.NoError(t, err, "handle failed")
+	err = router.Handle("student.v1.{id}", func(id int64) (Student, error) {
+		return Student{ID: int(id), Name: "foobar"}, nil
+	})
+	assert.NoError(t, err, "handle failed")
+	err = router.Handle("students.v1", func() (<-chan Student, error) {
+		students := make(chan Student)
+		go func() {
+			defer close(students)
+			for i := 0; i < 10; i++ {
+				students <- Student{ID: i}
+			}
+		}()
+		return students, nil
+	})
+	assert.NoError(t, err, "handle failed")
+
+	err = router.Handle("bad.{id}", func(a, b, c string) {})
+	assert.Error(t, err, "should fail with too many arguments")
+	err = router.Handle("bad.{id}", func(s Student) {})
+	assert.Error(t, err, "should fail with bad variable type")
+	err = router.Handle("bad", func() (int, int) { return 0, 0 })
+	assert.Error(t, err, "should fail with bad results")
+
+	requester, stop := startServer(t, router)
+	defer stop()
+
+	var result Result
+	err = requester.Route("student.v1.upsert").
+		Data(Student{Name: "foobar"}).
+		RetrieveMono().
+		BlockTo(context.Background(), &result)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, float64(1234), result.Data.(map[string]interface{})["id"], "bad result")
+
+	var student Student
+	err = requester.Route("student.v1.%d", 42).RetrieveMono().BlockTo(context.Background(), &student)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, 42, student.ID, "bad result")
+
+	err = requester.Route("student.v1.abc").RetrieveMono().BlockTo(context.Background(), &student)
+	assert.Error(t, err, "should fail with bad variable")
+
+	var students []Student
+	err = requester.Route("students.v1").RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request failed")
+	assert.Len(t, students, 10, "bad result")
+}
+
+func TestRouter_HandleWithSeparator(t *testing.T) {
+	router := messaging.NewRouter(messaging.Separator(messaging.SeparatorSlash))
+	// "{name}.md" is a literal segment of a slash router, so there's no variable to bind.
+	err := router.Handle("docs/{name}.md", func(c *messaging.RouteContext) string {
+		return c.Route()
+	})
+	assert.NoError(t, err, "handle failed")
+	err = router.Handle("files/{name}.json", func(data string) string {
+		return data
+	})
+	assert.NoError(t, err, "handle failed")
+	err = router.Handle("students/{id}/v1.2", func(id int) Student {
+		return Student{ID: id}
+	})
+	assert.NoError(t, err, "handle failed")
+	err = router.Handle("bad/{id}.x", func(id int, s Student) {})
+	assert.Error(t, err, "should fail with too many arguments")
+
+	requester, stop := startServer(t, router)
+	defer stop()
+
+	var route string
+	err = requester.Route(`docs/\{name\}.md`).RetrieveMono().BlockTo(context.Background(), &route)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, `docs/\{name\}.md`, route, "bad result")
+
+	var data string
+	err = requester.Route(`files/\{name\}.json`).Data("foobar").RetrieveMono().BlockTo(context.Background(), &data)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "foobar", data, "the argument should be bound to data")
+
+	var student Student
+	err = requester.Route("students/{id}/v1.2", 7).RetrieveMono().BlockTo(context.Background(), &student)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, 7, student.ID, "bad result")
+}
@@ -0,0 +1,111 @@
+package messaging_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/jjeffcaii/rsocket-messaging-go/spi"
+	"github.com/rsocket/rsocket-go/payload"
+	"github.com/rsocket/rsocket-go/rx/flux"
+	"github.com/rsocket/rsocket-go/rx/mono"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestBuilder_Interceptor(t *testing.T) {
+	router := messaging.NewRouter()
+	_ = router.Route("tenant", func(c *messaging.RouteContext) error {
+		var tenant string
+		_ = c.BindMetadata("text/plain", &tenant)
+		return c.Respond(tenant)
+	})
+	_ = router.Route("students.v2", func(c *messaging.RouteContext) error {
+		return c.RespondStream([]Student{{ID: 1}, {ID: 2}})
+	})
+	loopback, stop := serve(t, router)
+	defer stop()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+		nexts int32
+	)
+	logging := func(req *spi.Request, next spi.Invoker) spi.Response {
+		mu.Lock()
+		calls = append(calls, req.Type.String()+" "+req.Route)
+		mu.Unlock()
+		return next(req)
+	}
+	tenant := func(req *spi.Request, next spi.Invoker) spi.Response {
+		req.Metadata = append(req.Metadata, spi.MetadataEntry{MimeType: "text/plain", Content: []byte("foo")})
+		return next(req)
+	}
+	rewrite := func(req *spi.Request, next spi.Invoker) spi.Response {
+		if req.Route == "students.v1" {
+			req.Route = "students.v2"
+		}
+		return next(req)
+	}
+	cache := func(req *spi.Request, next spi.Invoker) spi.Response {
+		switch req.Route {
+		case "cached":
+			return spi.Response{Mono: mono.Just(payload.NewString(`"hit"`, ""))}
+		case "forbidden":
+			return spi.Response{Err: errors.New("forbidden")}
+		}
+		return next(req)
+	}
+	metrics := func(req *spi.Request, next spi.Invoker) spi.Response {
+		res := next(req)
+		if res.Flux != nil {
+			res.Flux = res.Flux.DoOnNext(func(payload.Payload) {
+				atomic.AddInt32(&nexts, 1)
+			})
+		}
+		return res
+	}
+
+	requester, err := messaging.Builder().
+		Interceptor(logging, tenant, rewrite, cache, metrics).
+		ConnectLoopback(loopback).
+		Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	var s string
+	err = requester.Route("tenant").RetrieveMono().BlockTo(context.Background(), &s)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "foo", s, "metadata should be added")
+
+	err = requester.Route("cached").RetrieveMono().BlockTo(context.Background(), &s)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "hit", s, "should be short-circuited")
+
+	err = requester.Route("forbidden").Retrieve()
+	assert.EqualError(t, err, "forbidden", "should be short-circuited")
+
+	var students []Student
+	err = requester.Route("students.v1").RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request failed")
+	assert.Len(t, students, 2, "route should be rewritten")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&nexts), "flux should be wrapped")
+
+	err = requester.Route("students.v1").
+		Data(flux.Just(payload.NewString(`{}`, ""))).
+		RetrieveFlux().
+		BlockToSlice(context.Background(), &students)
+	assert.Error(t, err, "no channel handler")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"RequestResponse tenant",
+		"RequestResponse cached",
+		"FireAndForget forbidden",
+		"RequestStream students.v1",
+		"RequestChannel students.v1",
+	}, calls, "bad calls")
+}
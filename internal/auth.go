@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	"github.com/rsocket/rsocket-go/extension"
+)
+
+// Well-known auth types, see: https://github.com/rsocket/rsocket/blob/master/Extensions/Security/WellKnownAuthTypes.md
+const (
+	AuthTypeSimple = "simple"
+	AuthTypeBearer = "bearer"
+)
+
+var errInvalidAuth = errors.New("invalid authentication metadata")
+
+func parseWellKnownAuthType(authType string) (id byte, ok bool) {
+	switch authType {
+	case AuthTypeSimple:
+		return 0x00, true
+	case AuthTypeBearer:
+		return 0x01, true
+	default:
+		return
+	}
+}
+
+// EncodeAuth encodes the content of message/x.rsocket.authentication.v0.
+func EncodeAuth(authType string, payload []byte) (raw []byte, err error) {
+	if id, ok := parseWellKnownAuthType(authType); ok {
+		raw = append(raw, id|0x80)
+		raw = append(raw, payload...)
+		return
+	}
+	if len(authType) < 1 || len(authType) > 0x80 {
+		err = errors.Errorf("invalid auth type length: %s", authType)
+		return
+	}
+	for i := 0; i < len(authType); i++ {
+		if authType[i] > 0x7F {
+			err = errors.Errorf("auth type must be ascii: %s", authType)
+			return
+		}
+	}
+	raw = append(raw, byte(len(authType)-1))
+	raw = append(raw, authType...)
+	raw = append(raw, payload...)
+	return
+}
+
+// EncodeSimpleAuth encodes the content of message/x.rsocket.authentication.v0 with simple auth type.
+func EncodeSimpleAuth(username, password string) ([]byte, error) {
+	if len(username) > 0xFFFF {
+		return nil, errors.New("username is too long")
+	}
+	payload := make([]byte, 2, 2+len(username)+len(password))
+	binary.BigEndian.PutUint16(payload, uint16(len(username)))
+	payload = append(payload, username...)
+	payload = append(payload, password...)
+	return EncodeAuth(AuthTypeSimple, payload)
+}
+
+// EncodeBearerAuth encodes the content of message/x.rsocket.authentication.v0 with bearer auth type.
+func EncodeBearerAuth(token string) ([]byte, error) {
+	return EncodeAuth(AuthTypeBearer, []byte(token))
+}
+
+// DecodeAuth decodes the content of message/x.rsocket.authentication.v0.
+func DecodeAuth(raw []byte) (authType string, payload []byte, err error) {
+	if len(raw) < 1 {
+		err = errInvalidAuth
+		return
+	}
+	first := raw[0]
+	if first&0x80 != 0 {
+		switch first & 0x7F {
+		case 0x00:
+			authType = AuthTypeSimple
+		case 0x01:
+			authType = AuthTypeBearer
+		default:
+			err = errors.Errorf("unknown well-known auth type: %d", first&0x7F)
+			return
+		}
+		payload = raw[1:]
+		return
+	}
+	n := int(first) + 1
+	if len(raw) < n+1 {
+		err = errInvalidAuth
+		return
+	}
+	authType = string(raw[1 : n+1])
+	payload = raw[n+1:]
+	return
+}
+
+// DecodeSimpleAuth decodes the payload of simple auth type.
+func DecodeSimpleAuth(payload []byte) (username, password string, err error) {
+	if len(payload) < 2 {
+		err = errInvalidAuth
+		return
+	}
+	n := int(binary.BigEndian.Uint16(payload))
+	if len(payload) < n+2 {
+		err = errInvalidAuth
+		return
+	}
+	username = string(payload[2 : n+2])
+	password = string(payload[n+2:])
+	return
+}
+
+// Auth returns the auth type and payload in message/x.rsocket.authentication.v0, present is false if there's no such
+// entry. A malformed entry is present with the decode error, so it's never mistaken for missing credentials.
+func (m MetadataEntries) Auth() (authType string, payload []byte, present bool, err error) {
+	raw, present := m.Get(extension.MessageAuthentication.String())
+	if !present {
+		return
+	}
+	authType, payload, err = DecodeAuth(raw)
+	return
+}
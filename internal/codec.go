@@ -7,22 +7,28 @@ import (
 	"io"
 	"io/ioutil"
 	"reflect"
+	"sort"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/rsocket/rsocket-go/extension"
+	"github.com/rsocket/rsocket-go/payload"
 )
 
 var (
 	errInvalidUnmarshalTarget = errors.New("invalid unmarshal target")
 	errRequireStringPtr       = errors.New("require string ptr")
 	errNilInterface           = errors.New("cannot unmarshal to nil target")
-	_codecs                   = make(map[string]codec)
 )
 
+// DefaultCodecRegistry is the global codec registry.
+var DefaultCodecRegistry = NewCodecRegistry()
+
 type (
-	writeable   = func(io.Writer) error
-	FnMarshal   = func(interface{}) ([]byte, error)
-	FnUnmarshal = func([]byte, interface{}) error
+	writeable       = func(io.Writer) error
+	FnMarshal       = func(interface{}) ([]byte, error)
+	FnUnmarshal     = func([]byte, interface{}) error
+	FnDecodePayload = func(payload.Payload, interface{}) error
 )
 
 type codec struct {
@@ -30,10 +36,29 @@ type codec struct {
 	dec FnUnmarshal
 }
 
-func init() {
-	_ = RegisterCodec(extension.ApplicationJSON.String(), json.Marshal, json.Unmarshal)
-	_ = RegisterCodec(extension.ApplicationXML.String(), xml.Marshal, xml.Unmarshal)
-	_ = RegisterCodec(extension.TextPlain.String(), func(v interface{}) ([]byte, error) {
+// CodecRegistry holds codecs by mime type, it's safe for concurrent use.
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]codec
+}
+
+// NewCodecRegistry creates a new codec registry with built-in codecs.
+func NewCodecRegistry() *CodecRegistry {
+	r := &CodecRegistry{
+		codecs: make(map[string]codec),
+	}
+	registerBuiltinCodecs(r)
+	return r
+}
+
+func registerBuiltinCodecs(r *CodecRegistry) {
+	_ = r.Register(extension.ApplicationJSON.String(), json.Marshal, json.Unmarshal)
+	_ = r.Register(extension.ApplicationXML.String(), xml.Marshal, xml.Unmarshal)
+	_ = r.Register(extension.ApplicationCBOR.String(), marshalCBOR, unmarshalCBOR)
+	_ = r.Register(MimeTypeMsgpack, marshalMsgpack, unmarshalMsgpack)
+	_ = r.Register(extension.ApplicationProtobuf.String(), marshalProtobuf, unmarshalProtobuf)
+	_ = r.Register(MimeTypeProtobuf, marshalProtobuf, unmarshalProtobuf)
+	_ = r.Register(extension.TextPlain.String(), func(v interface{}) ([]byte, error) {
 		switch vv := v.(type) {
 		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
 			return []byte(fmt.Sprintf("%d", vv)), nil
@@ -59,22 +84,28 @@ func init() {
 	})
 }
 
-func RegisterCodec(mimeType string, encoder FnMarshal, decoder FnUnmarshal) error {
+// Register registers a codec, the existing codec of the mime type will be replaced.
+func (r *CodecRegistry) Register(mimeType string, encoder FnMarshal, decoder FnUnmarshal) error {
 	if encoder == nil {
 		return errors.New("encoder is nil")
 	}
 	if decoder == nil {
 		return errors.New("decoder is nil")
 	}
-	_codecs[mimeType] = codec{
+	r.mu.Lock()
+	r.codecs[mimeType] = codec{
 		enc: encoder,
 		dec: decoder,
 	}
+	r.mu.Unlock()
 	return nil
 }
 
-func LoadCodec(mimeType string) (enc FnMarshal, dec FnUnmarshal, ok bool) {
-	found, ok := _codecs[mimeType]
+// Load returns the codec of the mime type.
+func (r *CodecRegistry) Load(mimeType string) (enc FnMarshal, dec FnUnmarshal, ok bool) {
+	r.mu.RLock()
+	found, ok := r.codecs[mimeType]
+	r.mu.RUnlock()
 	if !ok {
 		return
 	}
@@ -83,12 +114,35 @@ func LoadCodec(mimeType string) (enc FnMarshal, dec FnUnmarshal, ok bool) {
 	return
 }
 
-func UnmarshalWithMimeType(raw []byte, v interface{}, mimeType string) error {
-	_, dec, ok := LoadCodec(mimeType)
+// Remove removes the codec of the mime type, returns false if it doesn't exist.
+func (r *CodecRegistry) Remove(mimeType string) (ok bool) {
+	r.mu.Lock()
+	if _, ok = r.codecs[mimeType]; ok {
+		delete(r.codecs, mimeType)
+	}
+	r.mu.Unlock()
+	return
+}
+
+// MimeTypes returns all registered mime types in order.
+func (r *CodecRegistry) MimeTypes() []string {
+	r.mu.RLock()
+	mimeTypes := make([]string, 0, len(r.codecs))
+	for k := range r.codecs {
+		mimeTypes = append(mimeTypes, k)
+	}
+	r.mu.RUnlock()
+	sort.Strings(mimeTypes)
+	return mimeTypes
+}
+
+// Unmarshal decodes raw with the codec of the mime type. Without a codec, raw is copied as it is into a *string or a
+// *[]byte, and other targets are unsupported.
+func (r *CodecRegistry) Unmarshal(raw []byte, v interface{}, mimeType string) error {
+	_, dec, ok := r.Load(mimeType)
 	if ok {
 		return dec(raw, v)
 	}
-	// TODO: default unmarshal
 	if v == nil {
 		return errNilInterface
 	}
@@ -101,18 +155,18 @@ func UnmarshalWithMimeType(raw []byte, v interface{}, mimeType string) error {
 	case reflect.String:
 		value.Elem().SetString(string(raw))
 	case reflect.Slice:
-		if typ.Elem().Elem().Kind() == reflect.Uint8 {
+		if typ.Elem().Elem().Kind() != reflect.Uint8 {
 			return errInvalidUnmarshalTarget
 		}
-		value.Elem().SetBytes(raw)
+		value.Elem().SetBytes(append([]byte(nil), raw...))
 	default:
 		return errInvalidUnmarshalTarget
 	}
-	return errors.Errorf("cannot unmarshal for mime type %s", mimeType)
+	return nil
 }
 
-func MarshalWithMimeType(v interface{}, mimeType string) (raw []byte, err error) {
-	enc, _, ok := LoadCodec(mimeType)
+func (r *CodecRegistry) Marshal(v interface{}, mimeType string) (raw []byte, err error) {
+	enc, _, ok := r.Load(mimeType)
 	if ok {
 		raw, err = enc(v)
 		return
@@ -129,3 +183,53 @@ func MarshalWithMimeType(v interface{}, mimeType string) (raw []byte, err error)
 	}
 	return
 }
+
+// Negotiate returns the first acceptable mime type which has a codec, or the data mime type of request.
+func (r *CodecRegistry) Negotiate(dataMimeType string, accepts []string) string {
+	for _, it := range accepts {
+		if it == dataMimeType {
+			return it
+		}
+		if _, _, ok := r.Load(it); ok {
+			return it
+		}
+	}
+	return dataMimeType
+}
+
+// EncodeResponse encodes a response value with the mime type, which is reported by the metadata if it's different
+// from the data mime type of connection. Without composite metadata, the mime type is never reported.
+func (r *CodecRegistry) EncodeResponse(v interface{}, mimeType, dataMimeType, metadataMimeType string) (payload.Payload, error) {
+	data, err := r.Marshal(v, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	if mimeType == dataMimeType || metadataMimeType != extension.MessageCompositeMetadata.String() {
+		return payload.New(data, nil), nil
+	}
+	b, err := EncodeMimeType(mimeType)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := extension.NewCompositeMetadataBuilder().PushWellKnown(extension.MessageMimeType, b).Build()
+	if err != nil {
+		return nil, err
+	}
+	return payload.New(data, metadata), nil
+}
+
+func RegisterCodec(mimeType string, encoder FnMarshal, decoder FnUnmarshal) error {
+	return DefaultCodecRegistry.Register(mimeType, encoder, decoder)
+}
+
+func LoadCodec(mimeType string) (enc FnMarshal, dec FnUnmarshal, ok bool) {
+	return DefaultCodecRegistry.Load(mimeType)
+}
+
+func UnmarshalWithMimeType(raw []byte, v interface{}, mimeType string) error {
+	return DefaultCodecRegistry.Unmarshal(raw, v, mimeType)
+}
+
+func MarshalWithMimeType(v interface{}, mimeType string) (raw []byte, err error) {
+	return DefaultCodecRegistry.Marshal(v, mimeType)
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	// encode time as RFC3339 text like jackson with WRITE_DATES_AS_TIMESTAMPS disabled, the default of spring boot.
+	_cborEncMode, _ = cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	_cborDecMode, _ = cbor.DecOptions{}.DecMode()
+)
+
+// struct fields are named by "cbor" tag, or "json" tag if "cbor" tag is absent.
+func marshalCBOR(v interface{}) ([]byte, error) {
+	return _cborEncMode.Marshal(v)
+}
+
+func unmarshalCBOR(raw []byte, v interface{}) error {
+	if err := _cborDecMode.Unmarshal(raw, v); err != nil {
+		return err
+	}
+	normalizeCBOR(reflect.ValueOf(v))
+	return nil
+}
+
+// normalizeCBOR converts the decoded map[interface{}]interface{} to map[string]interface{} if all keys are strings,
+// so that dynamic values look the same as encoding/json.
+func normalizeCBOR(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			normalizeCBOR(value.Elem())
+		}
+	case reflect.Interface:
+		if !value.IsNil() && value.CanSet() {
+			value.Set(reflect.ValueOf(stringifyKeys(value.Interface())))
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if field := value.Field(i); field.CanSet() {
+				normalizeCBOR(field)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			normalizeCBOR(value.Index(i))
+		}
+	case reflect.Map:
+		if value.Type().Elem().Kind() != reflect.Interface {
+			return
+		}
+		iter := value.MapRange()
+		for iter.Next() {
+			if v := iter.Value(); !v.IsNil() {
+				value.SetMapIndex(iter.Key(), reflect.ValueOf(stringifyKeys(v.Interface())))
+			}
+		}
+	}
+}
+
+func stringifyKeys(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, it := range vv {
+			s, ok := k.(string)
+			if !ok {
+				return vv
+			}
+			m[s] = stringifyKeys(it)
+		}
+		return m
+	case map[string]interface{}:
+		for k, it := range vv {
+			vv[k] = stringifyKeys(it)
+		}
+		return vv
+	case []interface{}:
+		for i, it := range vv {
+			vv[i] = stringifyKeys(it)
+		}
+		return vv
+	default:
+		return v
+	}
+}
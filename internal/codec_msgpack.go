@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MimeTypeMsgpack is the mime type of MessagePack.
+const MimeTypeMsgpack = "application/x-msgpack"
+
+// struct fields are named by "msgpack" tag, or "json" tag if "msgpack" tag is absent.
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := msgpack.NewEncoder(&b)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func unmarshalMsgpack(raw []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(raw))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// MimeTypeProtobuf is the common mime type of protobuf besides the well-known one.
+const MimeTypeProtobuf = "application/x-protobuf"
+
+var _typeProtoMessage = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+func marshalProtobuf(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	// accept a message value, eg: a slice element of []pb.Foo
+	value := reflect.ValueOf(v)
+	if value.IsValid() && reflect.PtrTo(value.Type()).Implements(_typeProtoMessage) {
+		ptr := reflect.New(value.Type())
+		ptr.Elem().Set(value)
+		return proto.Marshal(ptr.Interface().(proto.Message))
+	}
+	return nil, errors.Errorf("cannot marshal %T as protobuf", v)
+}
+
+func unmarshalProtobuf(raw []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(raw, m)
+	}
+	// allocate message for a pointer of message pointer, eg: reflect.New(*pb.Foo)
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Ptr && !value.IsNil() && value.Elem().Kind() == reflect.Ptr && value.Elem().Type().Implements(_typeProtoMessage) {
+		m := reflect.New(value.Elem().Type().Elem())
+		if err := proto.Unmarshal(raw, m.Interface().(proto.Message)); err != nil {
+			return err
+		}
+		value.Elem().Set(m)
+		return nil
+	}
+	return errors.Errorf("cannot unmarshal protobuf to %T", v)
+}
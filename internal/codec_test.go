@@ -1,11 +1,19 @@
 package internal_test
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	. "github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/rsocket/rsocket-go/payload"
+	"github.com/rsocket/rsocket-go/rx/flux"
+	"github.com/rsocket/rsocket-go/rx/mono"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type Message struct {
@@ -30,3 +38,228 @@ func TestMarshalWithMimeType(t *testing.T) {
 	b, err = MarshalWithMimeType(msg, "unknown_mime_type")
 	assert.Error(t, err, "should marshal fail")
 }
+
+func TestUnmarshalWithMimeType(t *testing.T) {
+	var s string
+	assert.NoError(t, UnmarshalWithMimeType([]byte("foobar"), &s, "unknown_mime_type"), "unmarshal failed")
+	assert.Equal(t, "foobar", s, "bad result")
+
+	raw := []byte("foobar")
+	var b []byte
+	assert.NoError(t, UnmarshalWithMimeType(raw, &b, "unknown_mime_type"), "unmarshal failed")
+	assert.Equal(t, raw, b, "bad result")
+	raw[0] = 'F'
+	assert.Equal(t, "foobar", string(b), "should be copied")
+
+	var msg Message
+	assert.Error(t, UnmarshalWithMimeType([]byte("foobar"), &msg, "unknown_mime_type"), "should fail with struct")
+	var ints []int
+	assert.Error(t, UnmarshalWithMimeType([]byte("foobar"), &ints, "unknown_mime_type"), "should fail with []int")
+	assert.Error(t, UnmarshalWithMimeType([]byte("foobar"), s, "unknown_mime_type"), "should fail without ptr")
+	assert.Error(t, UnmarshalWithMimeType([]byte("foobar"), nil, "unknown_mime_type"), "should fail with nil")
+}
+
+func TestCodecRegistry(t *testing.T) {
+	r := NewCodecRegistry()
+	assert.Contains(t, r.MimeTypes(), "application/json", "bad builtin codecs")
+	builtins := len(r.MimeTypes())
+
+	upper := func(v interface{}) ([]byte, error) {
+		return []byte(strings.ToUpper(v.(string))), nil
+	}
+	lower := func(b []byte, v interface{}) error {
+		*(v.(*string)) = strings.ToLower(string(b))
+		return nil
+	}
+	assert.NoError(t, r.Register("text/x-upper", upper, lower), "register failed")
+	assert.Error(t, r.Register("text/x-upper", nil, lower), "should fail")
+	b, err := r.Marshal("foobar", "text/x-upper")
+	assert.NoError(t, err, "marshal failed")
+	assert.Equal(t, "FOOBAR", string(b), "bad result")
+	var s string
+	assert.NoError(t, r.Unmarshal(b, &s, "text/x-upper"), "unmarshal failed")
+	assert.Equal(t, "foobar", s, "bad result")
+
+	_, _, ok := LoadCodec("text/x-upper")
+	assert.False(t, ok, "should not affect the default registry")
+
+	assert.True(t, r.Remove("text/x-upper"), "remove failed")
+	assert.False(t, r.Remove("text/x-upper"), "remove twice should fail")
+	_, _, ok = r.Load("text/x-upper")
+	assert.False(t, ok, "should be removed")
+	assert.Len(t, r.MimeTypes(), builtins, "bad codecs")
+}
+
+func TestCodecRegistry_EncodeResponse(t *testing.T) {
+	r := NewCodecRegistry()
+	assert.Equal(t, "application/cbor", r.Negotiate("application/json", []string{"text/x-unknown", "application/cbor"}), "bad mime type")
+	assert.Equal(t, "text/x-raw", r.Negotiate("text/x-raw", []string{"text/x-raw"}), "request data mime type is acceptable")
+	assert.Equal(t, "application/json", r.Negotiate("application/json", nil), "bad mime type")
+
+	res, err := r.EncodeResponse(Message{ID: 1}, "application/json", "application/json", "message/x.rsocket.composite-metadata.v0")
+	assert.NoError(t, err, "encode failed")
+	_, ok := res.Metadata()
+	assert.False(t, ok, "the mime type of connection should not be reported")
+
+	res, err = r.EncodeResponse(Message{ID: 1}, "application/cbor", "application/json", "message/x.rsocket.composite-metadata.v0")
+	assert.NoError(t, err, "encode failed")
+	metadata, _ := res.Metadata()
+	entries, err := ParseMetadata(metadata, "message/x.rsocket.composite-metadata.v0")
+	assert.NoError(t, err, "parse metadata failed")
+	mimeType, ok := entries.MimeType()
+	assert.True(t, ok, "mime type should be reported")
+	assert.Equal(t, "application/cbor", mimeType, "bad mime type")
+
+	res, err = r.EncodeResponse(Message{ID: 1}, "application/cbor", "application/json", "application/json")
+	assert.NoError(t, err, "encode failed")
+	_, ok = res.Metadata()
+	assert.False(t, ok, "mime type requires composite metadata")
+
+	_, err = r.EncodeResponse(func() {}, "application/json", "application/json", "application/json")
+	assert.Error(t, err, "should fail")
+}
+
+func TestCodecRegistry_Concurrent(t *testing.T) {
+	r := NewCodecRegistry()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mimeType := fmt.Sprintf("application/x-test-%d", i)
+			for j := 0; j < 100; j++ {
+				_ = r.Register(mimeType, func(v interface{}) ([]byte, error) {
+					return nil, nil
+				}, func(b []byte, v interface{}) error {
+					return nil
+				})
+				_, _ = r.Marshal(j, "application/json")
+				_ = r.MimeTypes()
+				r.Remove(mimeType)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, r.MimeTypes(), len(NewCodecRegistry().MimeTypes()), "bad codecs")
+}
+
+func TestProtobufCodec(t *testing.T) {
+	for _, mimeType := range []string{"application/x-protobuf", "application/vnd.google.protobuf"} {
+		b, err := MarshalWithMimeType(wrapperspb.String("foobar"), mimeType)
+		assert.NoError(t, err, "marshal failed")
+		var v1 wrapperspb.StringValue
+		assert.NoError(t, UnmarshalWithMimeType(b, &v1, mimeType), "unmarshal failed")
+		assert.Equal(t, "foobar", v1.GetValue(), "bad result")
+		var v2 *wrapperspb.StringValue
+		assert.NoError(t, UnmarshalWithMimeType(b, &v2, mimeType), "unmarshal failed")
+		assert.Equal(t, "foobar", v2.GetValue(), "bad result")
+
+		_, err = MarshalWithMimeType("foobar", mimeType)
+		assert.Error(t, err, "should fail")
+		var s string
+		assert.Error(t, UnmarshalWithMimeType(b, &s, mimeType), "should fail")
+	}
+}
+
+func TestProtobufCodec_Reactive(t *testing.T) {
+	const mimeType = "application/x-protobuf"
+	dec := func(input payload.Payload, v interface{}) error {
+		return UnmarshalWithMimeType(input.Data(), v, mimeType)
+	}
+	var payloads []payload.Payload
+	for i := 0; i < 3; i++ {
+		b, err := MarshalWithMimeType(wrapperspb.Int64(int64(i)), mimeType)
+		assert.NoError(t, err, "marshal failed")
+		payloads = append(payloads, payload.New(b, nil))
+	}
+
+	var one wrapperspb.Int64Value
+	err := NewMonoWithDecoder(mono.Just(payloads[1]), dec).BlockTo(context.Background(), &one)
+	assert.NoError(t, err, "block failed")
+	assert.Equal(t, int64(1), one.GetValue(), "bad result")
+
+	var values []*wrapperspb.Int64Value
+	err = NewFluxWithDecoder(flux.Just(payloads...), dec).BlockToSlice(context.Background(), &values)
+	assert.NoError(t, err, "block failed")
+	assert.Len(t, values, 3, "bad result")
+	assert.Equal(t, int64(2), values[2].GetValue(), "bad result")
+
+	ch := make(chan *wrapperspb.Int64Value, 3)
+	err = NewFluxWithDecoder(flux.Just(payloads...), dec).BlockToChan(context.Background(), ch)
+	close(ch)
+	assert.NoError(t, err, "block failed")
+	var sum int64
+	for it := range ch {
+		sum += it.GetValue()
+	}
+	assert.Equal(t, int64(3), sum, "bad result")
+}
+
+func TestCBORCodec(t *testing.T) {
+	type student struct {
+		ID       int               `json:"id"`
+		Name     string            `json:"name,omitempty"`
+		Birth    time.Time         `json:"birth"`
+		Tags     []string          `json:"tags"`
+		Extra    interface{}       `json:"extra"`
+		Props    map[string]string `cbor:"properties"`
+		internal string
+	}
+	birth := time.Date(2020, 4, 28, 0, 0, 0, 0, time.UTC)
+	b, err := MarshalWithMimeType(student{
+		ID:    1,
+		Birth: birth,
+		Tags:  []string{"foo"},
+		Extra: map[string]interface{}{"score": 99},
+		Props: map[string]string{"k": "v"},
+	}, "application/cbor")
+	assert.NoError(t, err, "marshal failed")
+
+	var m map[string]interface{}
+	assert.NoError(t, UnmarshalWithMimeType(b, &m, "application/cbor"), "unmarshal failed")
+	assert.Equal(t, uint64(1), m["id"], "bad id")
+	assert.NotContains(t, m, "name", "should be omitted")
+	assert.Equal(t, "2020-04-28T00:00:00Z", m["birth"], "bad time format")
+	assert.Equal(t, map[string]interface{}{"k": "v"}, m["properties"], "bad cbor tag")
+	assert.Equal(t, map[string]interface{}{"score": uint64(99)}, m["extra"], "bad nested map")
+
+	var s student
+	assert.NoError(t, UnmarshalWithMimeType(b, &s, "application/cbor"), "unmarshal failed")
+	assert.Equal(t, 1, s.ID, "bad id")
+	assert.True(t, birth.Equal(s.Birth), "bad birth")
+	assert.Equal(t, []string{"foo"}, s.Tags, "bad tags")
+	assert.Equal(t, map[string]interface{}{"score": uint64(99)}, s.Extra, "bad extra")
+
+	var dynamic interface{}
+	assert.NoError(t, UnmarshalWithMimeType(b, &dynamic, "application/cbor"), "unmarshal failed")
+	assert.IsType(t, map[string]interface{}{}, dynamic, "bad dynamic value")
+
+	b, err = MarshalWithMimeType(map[int]string{1: "one"}, "application/cbor")
+	assert.NoError(t, err, "marshal failed")
+	assert.NoError(t, UnmarshalWithMimeType(b, &dynamic, "application/cbor"), "unmarshal failed")
+	assert.Equal(t, map[interface{}]interface{}{uint64(1): "one"}, dynamic, "non-string keys should be kept")
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	type student struct {
+		ID    int64  `json:"id"`
+		Name  string `json:"name,omitempty"`
+		Score int    `msgpack:"s"`
+	}
+	b, err := MarshalWithMimeType(student{ID: 1, Score: 99}, "application/x-msgpack")
+	assert.NoError(t, err, "marshal failed")
+
+	var m map[string]interface{}
+	assert.NoError(t, UnmarshalWithMimeType(b, &m, "application/x-msgpack"), "unmarshal failed")
+	assert.EqualValues(t, 1, m["id"], "bad id")
+	assert.Contains(t, m, "s", "bad msgpack tag")
+	assert.NotContains(t, m, "name", "should be omitted")
+
+	var s student
+	assert.NoError(t, UnmarshalWithMimeType(b, &s, "application/x-msgpack"), "unmarshal failed")
+	assert.Equal(t, student{ID: 1, Score: 99}, s, "bad result")
+
+	var dynamic interface{}
+	assert.NoError(t, UnmarshalWithMimeType(b, &dynamic, "application/x-msgpack"), "unmarshal failed")
+	assert.IsType(t, map[string]interface{}{}, dynamic, "bad dynamic value")
+}
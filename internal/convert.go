@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	_typeDuration        = reflect.TypeOf(time.Duration(0))
+	_typeTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// IsConvertible returns true if a string can be converted to the type.
+func IsConvertible(typ reflect.Type) bool {
+	if reflect.PtrTo(typ).Implements(_typeTextUnmarshaler) {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Ptr:
+		return IsConvertible(typ.Elem())
+	default:
+		return false
+	}
+}
+
+// ConvertString converts a string to a value of the type.
+// Supports basic kinds, time.Duration, pointers of them and any encoding.TextUnmarshaler.
+func ConvertString(s string, typ reflect.Type) (value reflect.Value, err error) {
+	ptr := reflect.New(typ)
+	value = ptr.Elem()
+	if u, ok := ptr.Interface().(encoding.TextUnmarshaler); ok {
+		err = u.UnmarshalText([]byte(s))
+		return
+	}
+	if typ == _typeDuration {
+		var d time.Duration
+		if d, err = time.ParseDuration(s); err == nil {
+			value.SetInt(int64(d))
+		}
+		return
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			value.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, typ.Bits()); err == nil {
+			value.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, typ.Bits()); err == nil {
+			value.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, typ.Bits()); err == nil {
+			value.SetFloat(f)
+		}
+	case reflect.Ptr:
+		var elem reflect.Value
+		if elem, err = ConvertString(s, typ.Elem()); err == nil {
+			p := reflect.New(typ.Elem())
+			p.Elem().Set(elem)
+			value.Set(p)
+		}
+	default:
+		err = errors.Errorf("cannot convert string to %s", typ)
+	}
+	return
+}
@@ -3,6 +3,8 @@ package internal
 import (
 	"context"
 	"reflect"
+	"sync"
+	"sync/atomic"
 
 	"github.com/jjeffcaii/rsocket-messaging-go/spi"
 	"github.com/pkg/errors"
@@ -18,7 +20,7 @@ var (
 
 type simpleFlux struct {
 	flux.Flux
-	dec func([]byte, interface{}) error
+	dec FnDecodePayload
 }
 
 func (s simpleFlux) BlockToChan(ctx context.Context, to interface{}) (err error) {
@@ -41,7 +43,7 @@ func (s simpleFlux) BlockToChan(ctx context.Context, to interface{}) (err error)
 		}).
 		Subscribe(ctx, rx.OnNext(func(input payload.Payload) {
 			newVal := reflect.New(elem)
-			if err := s.dec(input.Data(), newVal.Interface()); err != nil {
+			if err := s.dec(input, newVal.Interface()); err != nil {
 				panic(err)
 			}
 			sending := reflect.ValueOf(newVal.Elem().Interface())
@@ -73,7 +75,7 @@ func (s simpleFlux) BlockToSlice(ctx context.Context, to interface{}) (err error
 		}).
 		Subscribe(ctx, rx.OnNext(func(input payload.Payload) {
 			newVal := reflect.New(typ)
-			if err := s.dec(input.Data(), newVal.Interface()); err != nil {
+			if err := s.dec(input, newVal.Interface()); err != nil {
 				panic(err)
 			}
 			sending := reflect.ValueOf(newVal.Elem().Interface())
@@ -111,7 +113,7 @@ func (m mustErrFlux) BlockToSlice(ctx context.Context, to interface{}) error {
 	return err
 }
 
-func NewFluxWithDecoder(origin flux.Flux, dec func([]byte, interface{}) error) spi.Flux {
+func NewFluxWithDecoder(origin flux.Flux, dec FnDecodePayload) spi.Flux {
 	return &simpleFlux{
 		Flux: origin,
 		dec:  dec,
@@ -123,3 +125,142 @@ func NewFluxWithError(err error) spi.Flux {
 		Flux: flux.Error(err),
 	}
 }
+
+// NewFluxWithEmitter creates a flux which runs emit in a new goroutine once it's subscribed, and completes when emit
+// returns. emit sends values by sink.Next, which waits until the subscriber requests more, and the context of emit is
+// canceled when the subscription finishes. A panic of emit fails the flux, and the flux can be subscribed only once.
+func NewFluxWithEmitter(emit func(ctx context.Context, sink flux.Sink) error) flux.Flux {
+	e := &emitter{
+		notify:   make(chan struct{}, 1),
+		finished: make(chan struct{}),
+	}
+	return flux.
+		Create(func(ctx context.Context, sink flux.Sink) {
+			ctx, cancel := context.WithCancel(ctx)
+			go func() {
+				select {
+				case <-e.finished:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			go func() {
+				defer cancel()
+				err := tryEmit(ctx, emitterSink{Sink: sink, ctx: ctx, e: e}, emit)
+				if ctx.Err() != nil {
+					// cancelled by the subscriber
+					return
+				}
+				if err != nil {
+					// The sink of flux.Create drops the first error (reactor-go v0.1.1), so signal it twice.
+					sink.Error(err)
+					sink.Error(err)
+					return
+				}
+				sink.Complete()
+			}()
+		}).
+		DoOnRequest(e.request).
+		DoFinally(func(rx.SignalType) {
+			e.once.Do(func() {
+				close(e.finished)
+			})
+		})
+}
+
+// emitter tracks the demand of the subscriber, so the buffer of flux.Create never holds values which are not
+// requested. Otherwise they are lost or block the completion once the subscription is cancelled.
+type emitter struct {
+	demand   int64
+	notify   chan struct{}
+	finished chan struct{}
+	once     sync.Once
+}
+
+func (e *emitter) request(n int) {
+	atomic.AddInt64(&e.demand, int64(n))
+	select {
+	case e.notify <- struct{}{}:
+	default:
+	}
+}
+
+// acquire waits until a value is requested.
+func (e *emitter) acquire(ctx context.Context) error {
+	for {
+		if n := atomic.LoadInt64(&e.demand); n > 0 {
+			if atomic.CompareAndSwapInt64(&e.demand, n, n-1) {
+				return nil
+			}
+			continue
+		}
+		select {
+		case <-e.notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// emitterSink is the sink passed to emit, values are dropped once the subscription finishes.
+type emitterSink struct {
+	flux.Sink
+	ctx context.Context
+	e   *emitter
+}
+
+func (s emitterSink) Next(v payload.Payload) {
+	if s.e.acquire(s.ctx) == nil {
+		s.Sink.Next(v)
+	}
+}
+
+// Complete is ignored, emit returns instead.
+func (s emitterSink) Complete() {
+}
+
+// Error is ignored, emit returns the error instead.
+func (s emitterSink) Error(error) {
+}
+
+func tryEmit(ctx context.Context, sink flux.Sink, emit func(context.Context, flux.Sink) error) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.Errorf("emit failed: %v", e)
+		}
+	}()
+	return emit(ctx, sink)
+}
+
+// EmitValues encodes and emits every value of a slice, an array or a chan. A chan is received until it's closed or
+// ctx is done.
+func EmitValues(ctx context.Context, sink flux.Sink, values reflect.Value, encode func(interface{}) (payload.Payload, error)) error {
+	if values.Kind() != reflect.Chan {
+		for i := 0; i < values.Len(); i++ {
+			next, err := encode(values.Index(i).Interface())
+			if err != nil {
+				return err
+			}
+			sink.Next(next)
+		}
+		return nil
+	}
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: values},
+	}
+	for {
+		chosen, recv, ok := reflect.Select(cases)
+		if chosen == 0 {
+			return ctx.Err()
+		}
+		if !ok {
+			return nil
+		}
+		next, err := encode(recv.Interface())
+		if err != nil {
+			return err
+		}
+		sink.Next(next)
+	}
+}
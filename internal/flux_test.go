@@ -0,0 +1,67 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/rsocket/rsocket-go/payload"
+	"github.com/rsocket/rsocket-go/rx"
+	"github.com/rsocket/rsocket-go/rx/flux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFluxWithEmitter(t *testing.T) {
+	var calls int32
+	f := NewFluxWithEmitter(func(ctx context.Context, sink flux.Sink) error {
+		atomic.AddInt32(&calls, 1)
+		sink.Next(payload.NewString("foo", ""))
+		sink.Next(payload.NewString("bar", ""))
+		return nil
+	})
+	time.Sleep(10 * time.Millisecond)
+	assert.Zero(t, atomic.LoadInt32(&calls), "should emit after subscribed")
+
+	var values []string
+	f.
+		DoOnNext(func(input payload.Payload) {
+			values = append(values, input.DataUTF8())
+		}).
+		BlockLast(context.Background())
+	assert.Equal(t, []string{"foo", "bar"}, values, "bad values")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "bad calls")
+
+	_, err := NewFluxWithEmitter(func(context.Context, flux.Sink) error {
+		return errors.New("boom")
+	}).BlockLast(context.Background())
+	assert.EqualError(t, err, "boom", "bad error")
+
+	_, err = NewFluxWithEmitter(func(context.Context, flux.Sink) error {
+		var m map[string]int
+		m["boom"]++
+		return nil
+	}).BlockLast(context.Background())
+	assert.Error(t, err, "panic should fail the flux")
+
+	canceled := make(chan struct{})
+	var su rx.Subscription
+	NewFluxWithEmitter(func(ctx context.Context, sink flux.Sink) error {
+		sink.Next(payload.NewString("foo", ""))
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}).Subscribe(context.Background(), rx.OnSubscribe(func(s rx.Subscription) {
+		su = s
+		s.Request(1)
+	}), rx.OnNext(func(payload.Payload) {
+		su.Cancel()
+	}))
+	select {
+	case <-canceled:
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "context should be canceled with the subscription")
+	}
+}
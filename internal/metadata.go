@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"github.com/jjeffcaii/rsocket-messaging-go/spi"
+	"github.com/pkg/errors"
+	"github.com/rsocket/rsocket-go/extension"
+)
+
+var (
+	errNoRoute          = errors.New("no routing metadata")
+	errInvalidComposite = errors.New("invalid composite metadata")
+)
+
+type MetadataEntry = spi.MetadataEntry
+
+type MetadataEntries []MetadataEntry
+
+func (m MetadataEntries) Get(mimeType string) ([]byte, bool) {
+	for _, it := range m {
+		if it.MimeType == mimeType {
+			return it.Content, true
+		}
+	}
+	return nil, false
+}
+
+func (m MetadataEntries) Route() (route string, err error) {
+	raw, ok := m.Get(extension.MessageRouting.String())
+	if !ok {
+		err = errNoRoute
+		return
+	}
+	tags, err := extension.ParseRoutingTags(raw)
+	if err != nil {
+		return
+	}
+	if len(tags) < 1 {
+		err = errNoRoute
+		return
+	}
+	route = tags[0]
+	return
+}
+
+// ParseMetadata decodes raw metadata into entries, the metadata mime type must be composite or routing.
+func ParseMetadata(raw []byte, mimeType string) (entries MetadataEntries, err error) {
+	if len(raw) < 1 {
+		return
+	}
+	if mimeType != extension.MessageCompositeMetadata.String() {
+		entries = append(entries, MetadataEntry{
+			MimeType: mimeType,
+			Content:  raw,
+		})
+		return
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			entries = nil
+			err = errInvalidComposite
+		}
+	}()
+	scanner := extension.NewCompositeMetadataBytes(raw).Scanner()
+	for scanner.Scan() {
+		var entry MetadataEntry
+		entry.MimeType, entry.Content, err = scanner.Metadata()
+		if err != nil {
+			err = errors.Wrap(err, "decode composite metadata failed")
+			return
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// EncodeMimeType encodes a mime type as the content of message/x.rsocket.mime-type.v0.
+func EncodeMimeType(mimeType string) (raw []byte, err error) {
+	if id, ok := extension.ParseMIME(mimeType); ok {
+		raw = append(raw, byte(id)|0x80)
+		return
+	}
+	if len(mimeType) < 1 || len(mimeType) > 0x80 {
+		err = errors.Errorf("invalid mime type length: %s", mimeType)
+		return
+	}
+	raw = append(raw, byte(len(mimeType)-1))
+	raw = append(raw, mimeType...)
+	return
+}
+
+// EncodeMimeTypes encodes mime types as the content of message/x.rsocket.accept-mime-types.v0.
+func EncodeMimeTypes(mimeTypes ...string) (raw []byte, err error) {
+	for _, it := range mimeTypes {
+		var b []byte
+		if b, err = EncodeMimeType(it); err != nil {
+			return
+		}
+		raw = append(raw, b...)
+	}
+	return
+}
+
+// DecodeMimeTypes decodes the content of message/x.rsocket.mime-type.v0 or message/x.rsocket.accept-mime-types.v0.
+func DecodeMimeTypes(raw []byte) (mimeTypes []string, err error) {
+	for len(raw) > 0 {
+		first := raw[0]
+		if first&0x80 != 0 {
+			mimeTypes = append(mimeTypes, extension.MIME(first&0x7F).String())
+			raw = raw[1:]
+			continue
+		}
+		n := int(first) + 1
+		if len(raw) < n+1 {
+			err = errors.New("invalid mime type bytes")
+			return
+		}
+		mimeTypes = append(mimeTypes, string(raw[1:n+1]))
+		raw = raw[n+1:]
+	}
+	return
+}
+
+// MimeType returns the mime type in message/x.rsocket.mime-type.v0.
+func (m MetadataEntries) MimeType() (mimeType string, ok bool) {
+	raw, ok := m.Get(extension.MessageMimeType.String())
+	if !ok {
+		return
+	}
+	mimeTypes, err := DecodeMimeTypes(raw)
+	if err != nil || len(mimeTypes) != 1 {
+		ok = false
+		return
+	}
+	mimeType = mimeTypes[0]
+	return
+}
+
+// AcceptMimeTypes returns all mime types in message/x.rsocket.accept-mime-types.v0.
+func (m MetadataEntries) AcceptMimeTypes() (mimeTypes []string) {
+	for _, it := range m {
+		if it.MimeType != extension.MessageAcceptMimeTypes.String() {
+			continue
+		}
+		if values, err := DecodeMimeTypes(it.Content); err == nil {
+			mimeTypes = append(mimeTypes, values...)
+		}
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package internal_test
+
+import (
+	"testing"
+
+	. "github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/rsocket/rsocket-go/extension"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMimeTypes(t *testing.T) {
+	b, err := EncodeMimeType("application/json")
+	assert.NoError(t, err, "encode failed")
+	assert.Equal(t, []byte{0x80 | byte(extension.ApplicationJSON)}, b, "well-known mime type should be encoded as id")
+
+	b, err = EncodeMimeTypes("application/json", "application/x-custom")
+	assert.NoError(t, err, "encode failed")
+	mimeTypes, err := DecodeMimeTypes(b)
+	assert.NoError(t, err, "decode failed")
+	assert.Equal(t, []string{"application/json", "application/x-custom"}, mimeTypes, "bad result")
+
+	_, err = DecodeMimeTypes([]byte{0x10, 'a'})
+	assert.Error(t, err, "should fail")
+}
+
+func TestMetadataEntries(t *testing.T) {
+	routing, _ := extension.EncodeRouting("students.v1")
+	mimeType, _ := EncodeMimeType("text/plain")
+	raw, _ := extension.NewCompositeMetadataBuilder().
+		PushWellKnown(extension.MessageRouting, routing).
+		PushWellKnown(extension.MessageMimeType, mimeType).
+		Build()
+	entries, err := ParseMetadata(raw, extension.MessageCompositeMetadata.String())
+	assert.NoError(t, err, "parse failed")
+	route, err := entries.Route()
+	assert.NoError(t, err, "no route")
+	assert.Equal(t, "students.v1", route, "bad route")
+	found, ok := entries.MimeType()
+	assert.True(t, ok, "no mime type")
+	assert.Equal(t, "text/plain", found, "bad mime type")
+
+	_, err = ParseMetadata([]byte{0x01, 0x02}, extension.MessageCompositeMetadata.String())
+	assert.Error(t, err, "should fail")
+}
+
+func TestAuth(t *testing.T) {
+	b, err := EncodeSimpleAuth("user", "pass")
+	assert.NoError(t, err, "encode failed")
+	assert.Equal(t, []byte("\x80\x00\x04userpass"), b, "bad simple auth")
+	authType, payload, err := DecodeAuth(b)
+	assert.NoError(t, err, "decode failed")
+	assert.Equal(t, AuthTypeSimple, authType, "bad auth type")
+	username, password, err := DecodeSimpleAuth(payload)
+	assert.NoError(t, err, "decode failed")
+	assert.Equal(t, "user", username, "bad username")
+	assert.Equal(t, "pass", password, "bad password")
+
+	b, err = EncodeBearerAuth("token")
+	assert.NoError(t, err, "encode failed")
+	assert.Equal(t, []byte("\x81token"), b, "bad bearer auth")
+
+	b, err = EncodeAuth("x.custom", []byte("secret"))
+	assert.NoError(t, err, "encode failed")
+	assert.Equal(t, []byte("\x07x.customsecret"), b, "bad custom auth")
+	authType, payload, err = DecodeAuth(b)
+	assert.NoError(t, err, "decode failed")
+	assert.Equal(t, "x.custom", authType, "bad auth type")
+	assert.Equal(t, []byte("secret"), payload, "bad payload")
+
+	_, err = EncodeAuth("", nil)
+	assert.Error(t, err, "should fail")
+	_, err = EncodeAuth("中文", nil)
+	assert.Error(t, err, "should fail")
+	_, _, err = DecodeAuth([]byte{0x07, 'x'})
+	assert.Error(t, err, "should fail")
+	_, _, err = DecodeSimpleAuth([]byte{0x00, 0x04, 'u'})
+	assert.Error(t, err, "should fail")
+
+	entries := MetadataEntries{{MimeType: "message/x.rsocket.authentication.v0", Content: []byte("\x81token")}}
+	authType, payload, ok, err := entries.Auth()
+	assert.NoError(t, err, "decode auth failed")
+	assert.True(t, ok, "should have auth")
+	assert.Equal(t, AuthTypeBearer, authType, "bad auth type")
+	assert.Equal(t, []byte("token"), payload, "bad payload")
+
+	_, _, ok, err = MetadataEntries{}.Auth()
+	assert.NoError(t, err, "no auth should not fail")
+	assert.False(t, ok, "should have no auth")
+
+	entries = MetadataEntries{{MimeType: "message/x.rsocket.authentication.v0", Content: []byte{0x05}}}
+	_, _, ok, err = entries.Auth()
+	assert.True(t, ok, "malformed auth should be present")
+	assert.Error(t, err, "malformed auth should fail")
+}
@@ -5,16 +5,25 @@ import (
 	"bytes"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 )
 
 var errMakeString = errors.New("make string failed")
-var _regParam = regexp.MustCompilePOSIX("^\\{([a-zA-Z_][a-zA-Z0-9_]*)}$")
+var (
+	_regParam = regexp.MustCompilePOSIX("^\\{([a-zA-Z_][a-zA-Z0-9_]*)}$")
+	_regRest  = regexp.MustCompilePOSIX("^\\{\\*([a-zA-Z_][a-zA-Z0-9_]*)}$")
+	_regRegex = regexp.MustCompilePOSIX("^\\{([a-zA-Z_][a-zA-Z0-9_]*):(.+)}$")
+)
 
 const _any = "{}"
 
+// DefaultSeparators are separators of path segments by default, both '.' and '/' split a path.
+const DefaultSeparators = "./"
+
 func MkString(format string, args ...interface{}) (str string, err error) {
 	defer func() {
 		if e := recover(); e != nil {
@@ -31,13 +40,48 @@ type TrieNodeLeaf struct {
 	value        interface{}
 	paramIndices []int
 	paramNames   []string
+	pattern      string
+	catchAll     bool
+	score        int
+	constrained  int
+	length       int
+}
+
+// moreSpecific compares leaves like the PathPattern of spring: a catch-all pattern loses, then the one with fewer
+// variables and wildcards wins, then the one with more constrained variables wins, then the longer one wins.
+// Leaves which are equally specific are decided by the order of lookup.
+func (l *TrieNodeLeaf) moreSpecific(other *TrieNodeLeaf) bool {
+	if l.catchAll != other.catchAll {
+		return !l.catchAll
+	}
+	if l.catchAll && l.length != other.length {
+		return l.length > other.length
+	}
+	if l.score != other.score {
+		return l.score < other.score
+	}
+	if l.constrained != other.constrained {
+		return l.constrained > other.constrained
+	}
+	return l.length > other.length
 }
 
+// TrieNode is a node of the radix tree. Consecutive literal segments are compressed into one node, which is keyed by
+// the first segment in the literal children of its parent.
 type TrieNode struct {
 	name     string
+	segments []string
 	children map[string]*TrieNode
 	parent   *TrieNode
 	leaf     *TrieNodeLeaf
+	// regex of a constrained variable node, names of variables are kept by leaves.
+	regex *regexp.Regexp
+	// special children which are not matched literally, constrained variables are kept by order of registration.
+	constrained []*TrieNode
+	variable    *TrieNode
+	wildcard    *TrieNode
+	catchAll    *TrieNode
+	captureRest *TrieNode
 }
 
 func (t *TrieNode) IsLeaf() bool {
@@ -55,19 +99,285 @@ func (t *TrieNode) Name() string {
 	return t.name
 }
 
-func (t *TrieNode) getChild(path string) (*TrieNode, bool) {
-	found, ok := t.children[path]
-	return found, ok
+// literal returns the literal child of segments from i, and the index of next segment. It will be created if absent,
+// and a compressed node will be split if only a part of it is matched.
+func (t *TrieNode) literal(segments []segment, i int) (*TrieNode, int) {
+	found, ok := t.children[segments[i].text]
+	if !ok {
+		found = newTrieNode(t, segments[i].text)
+		for ; i < len(segments) && segments[i].kind == segmentLiteral; i++ {
+			found.segments = append(found.segments, segments[i].text)
+		}
+		t.children[found.name] = found
+		return found, i
+	}
+	n := 1
+	for n < len(found.segments) && i+n < len(segments) &&
+		segments[i+n].kind == segmentLiteral && segments[i+n].text == found.segments[n] {
+		n++
+	}
+	if n < len(found.segments) {
+		found.split(n)
+	}
+	return found, i + n
+}
+
+// split moves the segments from n and all children into a new child.
+func (t *TrieNode) split(n int) {
+	tail := &TrieNode{
+		name:        t.segments[n],
+		segments:    t.segments[n:],
+		children:    t.children,
+		parent:      t,
+		leaf:        t.leaf,
+		constrained: t.constrained,
+		variable:    t.variable,
+		wildcard:    t.wildcard,
+		catchAll:    t.catchAll,
+		captureRest: t.captureRest,
+	}
+	tail.eachChild(func(child *TrieNode) {
+		child.parent = tail
+	})
+	*t = TrieNode{
+		name:     t.name,
+		segments: t.segments[:n:n],
+		children: map[string]*TrieNode{tail.name: tail},
+		parent:   t.parent,
+	}
+}
+
+// child returns the child of a parsed pattern segment which is not a literal, it will be created if absent.
+// Variables at the same position share the node whatever their names are, only patterns of the same leaf conflict.
+func (t *TrieNode) child(seg segment) (found *TrieNode, err error) {
+	var slot **TrieNode
+	switch seg.kind {
+	case segmentConstrained:
+		key := seg.key()
+		for _, it := range t.constrained {
+			if it.name == key {
+				found = it
+				break
+			}
+		}
+		if found == nil {
+			var regex *regexp.Regexp
+			if regex, err = regexp.Compile("^(?:" + seg.regex + ")$"); err != nil {
+				err = errors.Wrapf(err, "bad regex of variable %s", seg.name)
+				return
+			}
+			found = newTrieNode(t, key)
+			found.regex = regex
+			t.constrained = append(t.constrained, found)
+		}
+	case segmentVariable:
+		slot = &t.variable
+	case segmentWildcard:
+		slot = &t.wildcard
+	case segmentCatchAll:
+		slot = &t.catchAll
+	case segmentCaptureRest:
+		slot = &t.captureRest
+	default:
+		err = errors.Errorf("unexpected literal segment %s", seg.text)
+		return
+	}
+	if slot != nil {
+		if *slot == nil {
+			*slot = newTrieNode(t, seg.key())
+		}
+		found = *slot
+	}
+	return
+}
+
+// lookup returns the existing child of segments from i, and the index of next segment.
+func (t *TrieNode) lookup(segments []segment, i int) (found *TrieNode, next int) {
+	seg := segments[i]
+	next = i + 1
+	switch seg.kind {
+	case segmentLiteral:
+		if found = t.children[seg.text]; found == nil {
+			return
+		}
+		for n := 1; n < len(found.segments); n++ {
+			if i+n >= len(segments) || segments[i+n].kind != segmentLiteral || segments[i+n].text != found.segments[n] {
+				return nil, 0
+			}
+		}
+		return found, i + len(found.segments)
+	case segmentConstrained:
+		key := seg.key()
+		for _, it := range t.constrained {
+			if it.name == key {
+				found = it
+			}
+		}
+	case segmentVariable:
+		found = t.variable
+	case segmentWildcard:
+		found = t.wildcard
+	case segmentCatchAll:
+		found = t.catchAll
+	case segmentCaptureRest:
+		found = t.captureRest
+	}
+	return
 }
 
-func (t *TrieNode) addChild(path string, child *TrieNode) {
-	if _, ok := t.children[path]; !ok {
-		t.children[path] = child
+func (t *TrieNode) eachChild(fn func(child *TrieNode)) {
+	for _, it := range t.children {
+		fn(it)
+	}
+	for _, it := range t.constrained {
+		fn(it)
+	}
+	for _, it := range []*TrieNode{t.variable, t.wildcard, t.catchAll, t.captureRest} {
+		if it != nil {
+			fn(it)
+		}
 	}
 }
 
+func (t *TrieNode) isEmpty() bool {
+	return t.leaf == nil && len(t.children) == 0 && len(t.constrained) == 0 &&
+		t.variable == nil && t.wildcard == nil && t.catchAll == nil && t.captureRest == nil
+}
+
+func (t *TrieNode) removeChild(child *TrieNode) {
+	switch child {
+	case t.variable:
+		t.variable = nil
+	case t.wildcard:
+		t.wildcard = nil
+	case t.catchAll:
+		t.catchAll = nil
+	case t.captureRest:
+		t.captureRest = nil
+	default:
+		if t.children[child.name] == child {
+			delete(t.children, child.name)
+			return
+		}
+		for i, it := range t.constrained {
+			if it == child {
+				t.constrained = append(t.constrained[:i:i], t.constrained[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// prune removes the node and its ancestors until a non-empty one.
+func (t *TrieNode) prune() {
+	for node := t; node.parent != nil && node.isEmpty(); node = node.parent {
+		node.parent.removeChild(node)
+	}
+}
+
+func (t *TrieNode) walkLeaves(fn func(*TrieNodeLeaf)) {
+	if t.leaf != nil {
+		fn(t.leaf)
+	}
+	t.eachChild(func(child *TrieNode) {
+		child.walkLeaves(fn)
+	})
+}
+
+func (t *TrieNode) clone(parent *TrieNode) *TrieNode {
+	if t == nil {
+		return nil
+	}
+	c := &TrieNode{
+		name:     t.name,
+		segments: t.segments,
+		children: make(map[string]*TrieNode, len(t.children)),
+		parent:   parent,
+		regex:    t.regex,
+	}
+	if t.leaf != nil {
+		leaf := *t.leaf
+		c.leaf = &leaf
+	}
+	for k, v := range t.children {
+		c.children[k] = v.clone(c)
+	}
+	for _, it := range t.constrained {
+		c.constrained = append(c.constrained, it.clone(c))
+	}
+	c.variable = t.variable.clone(c)
+	c.wildcard = t.wildcard.clone(c)
+	c.catchAll = t.catchAll.clone(c)
+	c.captureRest = t.captureRest.clone(c)
+	return c
+}
+
+type segmentKind uint8
+
+const (
+	segmentLiteral segmentKind = iota
+	segmentVariable
+	segmentConstrained
+	segmentWildcard
+	segmentCatchAll
+	segmentCaptureRest
+)
+
+type segment struct {
+	kind  segmentKind
+	text  string
+	name  string
+	regex string
+}
+
+func (s segment) key() string {
+	switch s.kind {
+	case segmentVariable:
+		return _any
+	case segmentConstrained:
+		return "{:" + s.regex + "}"
+	case segmentWildcard:
+		return "*"
+	case segmentCatchAll:
+		return "**"
+	case segmentCaptureRest:
+		return "{*}"
+	default:
+		return s.text
+	}
+}
+
+func parseSegment(part string) segment {
+	switch part {
+	case "*":
+		return segment{kind: segmentWildcard, text: part}
+	case "**":
+		return segment{kind: segmentCatchAll, text: part}
+	}
+	if groups := _regRest.FindStringSubmatch(part); len(groups) == 2 {
+		return segment{kind: segmentCaptureRest, text: part, name: groups[1]}
+	}
+	if groups := _regParam.FindStringSubmatch(part); len(groups) == 2 {
+		return segment{kind: segmentVariable, text: part, name: groups[1]}
+	}
+	if groups := _regRegex.FindStringSubmatch(part); len(groups) == 3 {
+		return segment{kind: segmentConstrained, text: part, name: groups[1], regex: groups[2]}
+	}
+	return segment{kind: segmentLiteral, text: Unescape(part)}
+}
+
+func parsePattern(path, separators string) (segments []segment) {
+	scanner := bufio.NewScanner(strings.NewReader(path))
+	scanner.Split(splitPattern(separators))
+	for scanner.Scan() {
+		segments = append(segments, parseSegment(scanner.Text()))
+	}
+	return
+}
+
 type PathTrie struct {
-	rootNode *TrieNode
+	rootNode   *TrieNode
+	separators string
 }
 
 type PathVariables struct {
@@ -111,116 +421,426 @@ func (p *PathVariables) GetOrCompute(name string, compute func() string) string
 	return v
 }
 
-func (p *PathTrie) Find(path string) (variables *PathVariables, value interface{}, ok bool) {
-	var m map[int]string
-	scanner := bufio.NewScanner(strings.NewReader(path))
-	scanner.Split(SplitPath)
-	parent := p.rootNode
-	count := 0
-	for scanner.Scan() {
-		part := scanner.Text()
-		child, exist := parent.getChild(part)
-		if !exist {
-			child, exist = parent.getChild(_any)
+var matchingPool = sync.Pool{
+	New: func() interface{} {
+		return new(matching)
+	},
+}
+
+// matching holds the state of a lookup, all branches are tried and the most specific leaf wins.
+// Children of a node are tried by the order: literal, constrained variables by registration, variable, "*", {*name}
+// and "**", so equally specific patterns are decided deterministically.
+// Segments are sliced from the path in place, and captures are indexed by the position of segment. It's pooled, so a
+// lookup doesn't allocate unless the matched pattern has variables.
+type matching struct {
+	path       string
+	separators string
+	captures   []string
+	best       *TrieNode
+	values     []string
+}
+
+func acquireMatching(path, separators string) *matching {
+	m := matchingPool.Get().(*matching)
+	m.path = path
+	m.separators = separators
+	n := 1
+	for pos := 0; pos < len(path); n++ {
+		_, pos = nextSegment(path, separators, pos)
+	}
+	if cap(m.captures) < n {
+		m.captures = make([]string, n)
+	}
+	m.captures = m.captures[:n]
+	return m
+}
+
+func (m *matching) release() {
+	for i := range m.captures {
+		m.captures[i] = ""
+	}
+	for i := range m.values {
+		m.values[i] = ""
+	}
+	m.path = ""
+	m.separators = ""
+	m.best = nil
+	matchingPool.Put(m)
+}
+
+// nextSegment returns the raw segment from pos and the position of next segment. It splits like SplitPath, but only
+// by the separators, and a separator escaped by '\' is a part of the segment.
+func nextSegment(path, separators string, pos int) (string, int) {
+	for i := pos; i < len(path); i++ {
+		c := path[i]
+		if c == '\\' {
+			i++
+			continue
+		}
+		if i > pos && strings.IndexByte(separators, c) >= 0 {
+			return path[pos:i], i + 1
+		}
+	}
+	return path[pos:], len(path)
+}
+
+// segment returns the unescaped segment from pos and the position of next segment.
+func (m *matching) segment(pos int) (string, int) {
+	part, next := nextSegment(m.path, m.separators, pos)
+	return Unescape(part), next
+}
+
+func (m *matching) walk(node *TrieNode, pos, i int) {
+	if pos >= len(m.path) {
+		m.offer(node)
+	} else {
+		part, next := m.segment(pos)
+		if child, ok := node.children[part]; ok {
+			m.walkLiteral(child, next, i+1)
+		}
+		for _, child := range node.constrained {
+			if child.regex.MatchString(part) {
+				m.captures[i] = part
+				m.walk(child, next, i+1)
+			}
+		}
+		if node.variable != nil {
+			m.captures[i] = part
+			m.walk(node.variable, next, i+1)
+		}
+		if node.wildcard != nil {
+			m.walk(node.wildcard, next, i+1)
+		}
+	}
+	// catch-all matches the rest segments, including none of them.
+	if node.captureRest != nil {
+		if pos < len(m.path) {
+			m.captures[i] = m.path[pos:]
+		} else {
+			m.captures[i] = ""
 		}
-		if !exist {
+		m.offer(node.captureRest)
+	}
+	if node.catchAll != nil {
+		m.offer(node.catchAll)
+	}
+}
+
+// walkLiteral matches the rest segments of a compressed node, whose first segment has been matched.
+func (m *matching) walkLiteral(node *TrieNode, pos, i int) {
+	for _, it := range node.segments[1:] {
+		if pos >= len(m.path) {
 			return
 		}
-		parent = child
-		if parent.name == _any {
-			if m == nil {
-				m = make(map[int]string)
+		var part string
+		if part, pos = m.segment(pos); part != it {
+			return
+		}
+		i++
+	}
+	m.walk(node, pos, i)
+}
+
+// reach returns the first node which consumes all segments, children are tried by the same order of walk.
+func (m *matching) reach(node *TrieNode, pos int) *TrieNode {
+	if pos >= len(m.path) {
+		return node
+	}
+	part, next := m.segment(pos)
+	if child, ok := node.children[part]; ok {
+		if found := m.reachLiteral(child, next); found != nil {
+			return found
+		}
+	}
+	for _, child := range node.constrained {
+		if child.regex.MatchString(part) {
+			if found := m.reach(child, next); found != nil {
+				return found
 			}
-			m[count] = part
 		}
-		count++
 	}
+	for _, child := range []*TrieNode{node.variable, node.wildcard} {
+		if child != nil {
+			if found := m.reach(child, next); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func (m *matching) reachLiteral(node *TrieNode, pos int) *TrieNode {
+	for n := 1; n < len(node.segments); n++ {
+		if pos >= len(m.path) {
+			// the path ends inside a compressed node, returns a detached node of the prefix.
+			return &TrieNode{
+				name:     node.name,
+				segments: node.segments[:n:n],
+				parent:   node.parent,
+			}
+		}
+		var part string
+		if part, pos = m.segment(pos); part != node.segments[n] {
+			return nil
+		}
+	}
+	return m.reach(node, pos)
+}
 
-	leaf := parent.leaf
-	if leaf == nil {
+func (m *matching) offer(node *TrieNode) {
+	if node.leaf == nil {
 		return
 	}
-	ok = true
-	value = leaf.value
-	variablesAmount := len(leaf.paramIndices)
-	if variablesAmount < 1 {
+	// the first one wins if they are equally specific
+	if m.best != nil && !node.leaf.moreSpecific(m.best.leaf) {
 		return
 	}
-	variables = &PathVariables{}
-	for i := 0; i < variablesAmount; i++ {
-		index := leaf.paramIndices[i]
-		name := leaf.paramNames[i]
-		v, ok := m[index]
-		if !ok {
-			continue
-		}
-		variables.names = append(variables.names, name)
-		variables.variables = append(variables.variables, v)
+	m.best = node
+	if len(node.leaf.paramIndices) > 0 {
+		m.values = append(m.values[:0], m.captures...)
 	}
+}
+
+func (m *matching) variables() *PathVariables {
+	leaf := m.best.leaf
+	if len(leaf.paramIndices) < 1 {
+		return nil
+	}
+	variables := &PathVariables{
+		names:     leaf.paramNames,
+		variables: make([]string, len(leaf.paramIndices)),
+	}
+	for i, index := range leaf.paramIndices {
+		variables.variables[i] = m.values[index]
+	}
+	return variables
+}
+
+// Find returns the value and variables of the most specific pattern which matches the path.
+func (p *PathTrie) Find(path string) (variables *PathVariables, value interface{}, ok bool) {
+	m := acquireMatching(path, p.separators)
+	defer m.release()
+	m.walk(p.rootNode, 0, 0)
+	if m.best == nil {
+		return
+	}
+	ok = true
+	value = m.best.leaf.value
+	variables = m.variables()
 	return
 }
 
+// Load returns the node of the most specific pattern which matches the path, or the first node reached by the path if
+// no pattern matches.
 func (p *PathTrie) Load(path string) (*TrieNode, bool) {
-	scanner := bufio.NewScanner(strings.NewReader(path))
-	scanner.Split(SplitPath)
+	m := acquireMatching(path, p.separators)
+	defer m.release()
+	m.walk(p.rootNode, 0, 0)
+	if m.best != nil {
+		return m.best, true
+	}
+	found := m.reach(p.rootNode, 0)
+	return found, found != nil
+}
+
+func (p *PathTrie) AddPath(path string, value interface{}) (err error) {
+	return p.ComputePath(path, func(old interface{}, exist bool) (interface{}, error) {
+		if exist {
+			return nil, errors.Errorf("conflict path %s", path)
+		}
+		return value, nil
+	})
+}
+
+// ComputePath sets the value of path to the result of compute, which receives the existing value if present.
+// Besides literals and {name} variables, a segment can be {name:regex} which is a variable constrained by the regex,
+// "*" which matches any segment, "**" which matches the rest segments, or {*name} which captures the rest segments.
+// The last two are only allowed at the end. A separator or a reserved character escaped by '\' is a part of literal.
+// Nothing is left in the trie if it fails.
+func (p *PathTrie) ComputePath(path string, compute func(old interface{}, exist bool) (interface{}, error)) (err error) {
+	leaf := &TrieNodeLeaf{
+		pattern: path,
+	}
+	segments := parsePattern(path, p.separators)
+	for i, seg := range segments {
+		if i > 0 {
+			leaf.length++
+		}
+		switch seg.kind {
+		case segmentLiteral:
+			leaf.length += len(seg.text)
+		case segmentVariable, segmentConstrained, segmentCaptureRest:
+			if seg.kind == segmentConstrained {
+				leaf.constrained++
+			}
+			leaf.paramIndices = append(leaf.paramIndices, i)
+			leaf.paramNames = append(leaf.paramNames, seg.name)
+			leaf.score++
+			leaf.length++
+		default:
+			leaf.score += 100
+			leaf.length++
+		}
+		if seg.kind == segmentCatchAll || seg.kind == segmentCaptureRest {
+			if i < len(segments)-1 {
+				return errors.Errorf("%s is only allowed at the end: %s", seg.text, path)
+			}
+			leaf.catchAll = true
+		}
+	}
 	parent := p.rootNode
-	for scanner.Scan() {
-		part := scanner.Text()
-		child, ok := parent.getChild(part)
-		if !ok {
-			child, ok = parent.getChild(_any)
+	defer func() {
+		if err != nil {
+			// remove the nodes created for path
+			parent.prune()
+		}
+	}()
+	for i := 0; i < len(segments); {
+		if segments[i].kind == segmentLiteral {
+			parent, i = parent.literal(segments, i)
+			continue
 		}
-		if !ok {
-			return nil, false
+		child, err := parent.child(segments[i])
+		if err != nil {
+			return err
 		}
 		parent = child
+		i++
+	}
+	if parent.leaf != nil {
+		if !sameNames(parent.leaf.paramNames, leaf.paramNames) {
+			return errors.Errorf("conflict path %s", path)
+		}
+		var value interface{}
+		if value, err = compute(parent.leaf.value, true); err != nil {
+			return
+		}
+		parent.leaf.value = value
+		return
 	}
-	return parent, true
+	value, err := compute(nil, false)
+	if err != nil {
+		return
+	}
+	leaf.value = value
+	parent.leaf = leaf
+	return
 }
 
-func (p *PathTrie) AddPath(path string, value interface{}) (err error) {
-	var (
-		indices []int
-		names   []string
-	)
-	scanner := bufio.NewScanner(strings.NewReader(path))
-	scanner.Split(SplitPath)
-	parent := p.rootNode
-	count := 0
-	for scanner.Scan() {
-		part := scanner.Text()
+func sameNames(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
 
-		// match {...} pattern
-		groups := _regParam.FindStringSubmatch(part)
-		if len(groups) == 2 {
-			indices = append(indices, count)
-			names = append(names, groups[1])
-			part = _any
-		}
+// ParseVariableNames returns names of variables in the path pattern split by the separators, by order.
+func ParseVariableNames(path, separators string) (names []string) {
+	return parseVariableNames(parsePattern(path, separators))
+}
 
-		child, ok := parent.getChild(part)
-		if !ok {
-			child = newTrieNode(parent, part)
-			parent.addChild(part, child)
+func parseVariableNames(segments []segment) (names []string) {
+	for _, seg := range segments {
+		if seg.name != "" {
+			names = append(names, seg.name)
 		}
-		parent = child
-		count++
 	}
-	if parent.leaf != nil {
-		return errors.Errorf("conflict path %s", path)
+	return
+}
+
+// RemovePath removes the pattern which is registered exactly as path, and returns the removed value.
+func (p *PathTrie) RemovePath(path string) (value interface{}, ok bool) {
+	segments := parsePattern(path, p.separators)
+	node := p.rootNode
+	for i := 0; i < len(segments); {
+		if node, i = node.lookup(segments, i); node == nil {
+			return
+		}
 	}
-	parent.leaf = &TrieNodeLeaf{
-		value:        value,
-		paramIndices: indices,
-		paramNames:   names,
+	if node.leaf == nil || !sameNames(node.leaf.paramNames, parseVariableNames(segments)) {
+		return
 	}
+	value, ok = node.leaf.value, true
+	node.leaf = nil
+	node.prune()
 	return
 }
 
+// Walk calls fn with the pattern and value of each leaf, sorted by pattern.
+func (p *PathTrie) Walk(fn func(pattern string, value interface{})) {
+	var leaves []*TrieNodeLeaf
+	p.rootNode.walkLeaves(func(leaf *TrieNodeLeaf) {
+		leaves = append(leaves, leaf)
+	})
+	sort.Slice(leaves, func(i, j int) bool {
+		return leaves[i].pattern < leaves[j].pattern
+	})
+	for _, it := range leaves {
+		fn(it.pattern, it.value)
+	}
+}
+
+// Clone returns a deep copy of the trie, values are shared.
+func (p *PathTrie) Clone() *PathTrie {
+	return &PathTrie{
+		rootNode:   p.rootNode.clone(nil),
+		separators: p.separators,
+	}
+}
+
+// TrimSegment removes the last segment of path, it returns false if there's only one segment.
+func (p *PathTrie) TrimSegment(path string) (string, bool) {
+	last := -1
+	for pos := 0; pos < len(path); {
+		_, next := nextSegment(path, p.separators, pos)
+		if next < len(path) {
+			last = next - 1
+		}
+		pos = next
+	}
+	if last < 0 {
+		return path, false
+	}
+	return path[:last], true
+}
+
 func NewPathTrie() *PathTrie {
+	return NewPathTrieWithSeparators(DefaultSeparators)
+}
+
+// NewPathTrieWithSeparators creates a PathTrie which splits paths by any of the separators, eg: "." or "/".
+func NewPathTrieWithSeparators(separators string) *PathTrie {
 	return &PathTrie{
-		rootNode: newTrieNode(nil, ""),
+		rootNode:   newTrieNode(nil, ""),
+		separators: separators,
+	}
+}
+
+// Unescape removes '\' which escapes the next character of a segment.
+func Unescape(segment string) string {
+	if strings.IndexByte(segment, '\\') < 0 {
+		return segment
+	}
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		if segment[i] == '\\' && i+1 < len(segment) {
+			i++
+		}
+		b.WriteByte(segment[i])
 	}
+	return b.String()
+}
+
+// Escape escapes '\' and the separators in segment, so it can be matched as a single segment.
+func Escape(segment, separators string) string {
+	if strings.IndexAny(segment, separators+"\\") < 0 {
+		return segment
+	}
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		if c := segment[i]; c == '\\' || strings.IndexByte(separators, c) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(segment[i])
+	}
+	return b.String()
 }
 
 func SplitPath(data []byte, atEOF bool) (advance int, token []byte, err error) {
@@ -243,6 +863,34 @@ func SplitPath(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	return 0, nil, nil
 }
 
+// splitPattern splits a path pattern by the separators, but the escaped ones and the ones inside braces are kept.
+func splitPattern(separators string) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		depth := 0
+		for i := 0; i < len(data); i++ {
+			switch b := data[i]; b {
+			case '\\':
+				i++
+			case '{':
+				depth++
+			case '}':
+				depth--
+			default:
+				if i > 0 && depth == 0 && strings.IndexByte(separators, b) >= 0 {
+					return i + 1, data[0:i], nil
+				}
+			}
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
 func newTrieNode(parent *TrieNode, path string) *TrieNode {
 	return &TrieNode{
 		parent:   parent,
@@ -2,6 +2,7 @@ package internal_test
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -78,3 +79,281 @@ func TestSplitPath(t *testing.T) {
 	}
 	assert.Equal(t, "foo,bar", strings.Join(results, ","))
 }
+
+func TestWildcards(t *testing.T) {
+	pt := NewPathTrie()
+	assert.NoError(t, pt.AddPath("files.**", "catch all"))
+	assert.NoError(t, pt.AddPath("files.{*rest}", "capture rest"))
+	assert.NoError(t, pt.AddPath("files.*.meta", "wildcard"))
+	assert.NoError(t, pt.AddPath("files.{name}.meta", "variable"))
+	assert.NoError(t, pt.AddPath("files.readme.meta", "literal"))
+	assert.NoError(t, pt.AddPath("files.docs.{*rest}", "longer capture rest"))
+	assert.Error(t, pt.AddPath("files.**.meta", 0), "** should be the last segment")
+	assert.Error(t, pt.AddPath("files.{*rest}.meta", 0), "{*rest} should be the last segment")
+
+	for _, it := range []struct {
+		path, value, rest string
+	}{
+		{"files.readme.meta", "literal", ""},
+		{"files.a.meta", "variable", ""},
+		{"files.a.b.meta", "capture rest", "a.b.meta"},
+		{"files", "capture rest", ""},
+		{"files.docs.a.b", "longer capture rest", "a.b"},
+	} {
+		variables, value, ok := pt.Find(it.path)
+		assert.True(t, ok, "find %s failed", it.path)
+		assert.Equal(t, it.value, value, "bad value of %s", it.path)
+		assert.Equal(t, it.rest, variables.GetOrDefault("rest", ""), "bad rest of %s", it.path)
+	}
+	variables, _, _ := pt.Find("files.a.meta")
+	assert.Equal(t, "a", variables.GetOrDefault("name", ""), "bad path var")
+
+	// "*" loses to a variable but still wins over a catch-all
+	pt = NewPathTrie()
+	assert.NoError(t, pt.AddPath("a.*.c", 1))
+	assert.NoError(t, pt.AddPath("a.**", 2))
+	_, value, ok := pt.Find("a.b.c")
+	assert.True(t, ok, "find failed")
+	assert.Equal(t, 1, value, "bad value")
+	_, value, _ = pt.Find("a.b.d")
+	assert.Equal(t, 2, value, "bad value")
+	_, _, ok = pt.Find("b")
+	assert.False(t, ok, "should not match")
+	assert.Equal(t, []string{"id", "rest"}, ParseVariableNames("a.{id}.*.{*rest}", DefaultSeparators), "bad names")
+	assert.Empty(t, ParseVariableNames("docs/{name}.md", "/"), "{name}.md should be a literal")
+}
+
+func TestConstrainedVariables(t *testing.T) {
+	pt := NewPathTrie()
+	assert.NoError(t, pt.AddPath("student.v1.{txt}", "text"))
+	assert.NoError(t, pt.AddPath("student.v1.{id:[0-9]+}", "id"))
+	assert.NoError(t, pt.AddPath("student.v1.{code:[a-z]+[0-9]}", "code"))
+	assert.NoError(t, pt.AddPath("student.v1.{name:[a-z]+}", "name"))
+	assert.NoError(t, pt.AddPath("reports.{year:[0-9]{4}}.{id:[0-9]+}.info", "report"))
+	assert.NoError(t, pt.AddPath("reports.{x}.{y}.{z}", "fallback"))
+	assert.Error(t, pt.AddPath("student.v2.{id:[0-9}", 0), "bad regex")
+
+	for _, it := range []struct {
+		path, value, name, variable string
+	}{
+		{"student.v1.42", "id", "id", "42"},
+		{"student.v1.abc1", "code", "code", "abc1"},
+		{"student.v1.abc", "name", "name", "abc"},
+		{"student.v1.A-1", "text", "txt", "A-1"},
+		{"reports.2020.7.info", "report", "year", "2020"},
+		{"reports.20.7.info", "fallback", "z", "info"},
+	} {
+		variables, value, ok := pt.Find(it.path)
+		assert.True(t, ok, "find %s failed", it.path)
+		assert.Equal(t, it.value, value, "bad value of %s", it.path)
+		assert.Equal(t, it.variable, variables.GetOrDefault(it.name, ""), "bad variable of %s", it.path)
+	}
+	assert.Equal(t, []string{"year", "id"}, ParseVariableNames("reports.{year:[0-9]{4}}.{id:[0-9]+}.info", DefaultSeparators))
+}
+
+func TestBacktracking(t *testing.T) {
+	pt := NewPathTrie()
+	assert.NoError(t, pt.AddPath("a.b.c", 1))
+	assert.NoError(t, pt.AddPath("a.{x}.d", 2))
+	assert.NoError(t, pt.AddPath("a.{x}.c", 3))
+	assert.NoError(t, pt.AddPath("a.b.{y}.e", 4))
+
+	variables, value, ok := pt.Find("a.b.d")
+	assert.True(t, ok, "should fall back to variable")
+	assert.Equal(t, 2, value, "bad value")
+	assert.Equal(t, "b", variables.GetOrDefault("x", ""), "bad path var")
+	_, value, _ = pt.Find("a.b.c")
+	assert.Equal(t, 1, value, "literal should win")
+	_, value, _ = pt.Find("a.z.c")
+	assert.Equal(t, 3, value, "bad value")
+
+	node, ok := pt.Load("a.b.d")
+	assert.True(t, ok, "load failed")
+	assert.Equal(t, 2, node.Value(), "bad value")
+	node, ok = pt.Load("a.z")
+	assert.True(t, ok, "load failed")
+	assert.False(t, node.IsLeaf(), "should be a prefix")
+	_, ok = pt.Load("a.b.x.x")
+	assert.False(t, ok, "should not be found")
+
+	// equally specific patterns are decided by the order of lookup, literal first.
+	pt = NewPathTrie()
+	assert.NoError(t, pt.AddPath("a.{x}.c", 1))
+	assert.NoError(t, pt.AddPath("a.b.{y}", 2))
+	for i := 0; i < 10; i++ {
+		_, value, _ = pt.Find("a.b.c")
+		assert.Equal(t, 2, value, "should be deterministic")
+	}
+}
+
+func TestAmbiguousPath(t *testing.T) {
+	pt := NewPathTrie()
+	assert.NoError(t, pt.AddPath("students.{id}", 1))
+	assert.NoError(t, pt.AddPath("students.{id}.courses", 2))
+	assert.Error(t, pt.AddPath("students.{name}", 3), "should conflict")
+	assert.NoError(t, pt.AddPath("students.{name}.scores", 3))
+	assert.NoError(t, pt.AddPath("students.{id:[0-9]+}.grades", 4))
+	assert.NoError(t, pt.AddPath("students.{no:[0-9]+}", 5))
+	assert.Error(t, pt.AddPath("students.{id:[0-9]+}", 6), "should conflict")
+	assert.NoError(t, pt.AddPath("students.{name:[a-z]+}", 6))
+	assert.NoError(t, pt.AddPath("files.{*path}", 7))
+	assert.Error(t, pt.AddPath("files.{*rest}", 8), "should conflict")
+	assert.Error(t, pt.AddPath("files.**.x", 8), "should conflict")
+
+	for path, expect := range map[string]struct {
+		value    int
+		name     string
+		variable string
+	}{
+		"students.x-1":        {1, "id", "x-1"},
+		"students.1.courses":  {2, "id", "1"},
+		"students.foo.scores": {3, "name", "foo"},
+		"students.1.grades":   {4, "id", "1"},
+		"students.1":          {5, "no", "1"},
+		"students.foo":        {6, "name", "foo"},
+		"files.a.b":           {7, "path", "a.b"},
+	} {
+		variables, value, ok := pt.Find(path)
+		assert.True(t, ok, "find %s failed", path)
+		assert.Equal(t, expect.value, value, "bad value of %s", path)
+		assert.Equal(t, expect.variable, variables.GetOrDefault(expect.name, ""), "bad path var of %s", path)
+	}
+
+	_, ok := pt.RemovePath("students.{name}.courses")
+	assert.False(t, ok, "names of variables should match")
+	value, ok := pt.RemovePath("students.{name}.scores")
+	assert.True(t, ok, "remove failed")
+	assert.Equal(t, 3, value, "bad value")
+	_, value, _ = pt.Find("students.1.courses")
+	assert.Equal(t, 2, value, "others should be kept")
+}
+
+func TestComputePath_Rollback(t *testing.T) {
+	pt := NewPathTrie()
+	assert.NoError(t, pt.AddPath("students.{id}", 1))
+	assert.Error(t, pt.AddPath("teachers.{id}.courses.{no:(}", 2), "bad regex should fail")
+	assert.Error(t, pt.ComputePath("students.{id}.courses", func(interface{}, bool) (interface{}, error) {
+		return nil, errors.New("boom")
+	}), "compute should fail")
+
+	var patterns []string
+	pt.Walk(func(pattern string, _ interface{}) {
+		patterns = append(patterns, pattern)
+	})
+	assert.Equal(t, []string{"students.{id}"}, patterns, "bad patterns")
+	for _, path := range []string{"teachers", "teachers.1.courses", "students.1.courses"} {
+		_, ok := pt.Load(path)
+		assert.False(t, ok, "%s should be rolled back", path)
+	}
+}
+
+func TestCompressedPath(t *testing.T) {
+	pt := NewPathTrie()
+	assert.NoError(t, pt.AddPath("a.b.c.d", 1))
+	assert.NoError(t, pt.AddPath("a.b.x", 2))
+	assert.NoError(t, pt.AddPath("a.b", 3))
+	assert.NoError(t, pt.AddPath("a.b.c.{id}", 4))
+	assert.Error(t, pt.AddPath("a/b/c/d", 5), "should conflict")
+
+	for path, expect := range map[string]int{"a.b.c.d": 1, "a.b.x": 2, "a.b": 3, "a.b.c.e": 4} {
+		_, value, ok := pt.Find(path)
+		assert.True(t, ok, "find %s failed", path)
+		assert.Equal(t, expect, value, "bad value of %s", path)
+	}
+	for _, path := range []string{"a", "a.b.c", "a.b.y", "a.b.c.d.e"} {
+		_, _, ok := pt.Find(path)
+		assert.False(t, ok, "%s should not be found", path)
+	}
+	node, ok := pt.Load("a")
+	assert.True(t, ok, "load failed")
+	assert.False(t, node.IsLeaf(), "should be a prefix")
+
+	value, ok := pt.RemovePath("a.b")
+	assert.True(t, ok, "remove failed")
+	assert.Equal(t, 3, value, "bad value")
+	_, ok = pt.RemovePath("a.b")
+	assert.False(t, ok, "should be removed")
+	_, ok = pt.RemovePath("a.b.c")
+	assert.False(t, ok, "should not be found")
+	_, value, _ = pt.Find("a.b.c.d")
+	assert.Equal(t, 1, value, "bad value")
+}
+
+func TestFindAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not stable with race detector")
+	}
+	pt := NewPathTrie()
+	_ = pt.AddPath("student.v1.upsert", 1)
+	_ = pt.AddPath("student.v1.{id}", 2)
+	_ = pt.AddPath("student.v1.{id:[0-9]+}.courses", 3)
+	_ = pt.AddPath("files.**", 4)
+	for _, path := range []string{"student.v1.upsert", "files.a.b"} {
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _, _ = pt.Find(path)
+		})
+		assert.Zero(t, allocs, "find %s should not allocate", path)
+	}
+}
+
+func BenchmarkPathTrie_Find(b *testing.B) {
+	pt := NewPathTrie()
+	for i := 0; i < 100; i++ {
+		_ = pt.AddPath(fmt.Sprintf("service%d.v1.upsert", i), i)
+		_ = pt.AddPath(fmt.Sprintf("service%d.v1.{id}.detail", i), i)
+	}
+	for _, path := range []string{"service50.v1.upsert", "service50.v1.42.detail"} {
+		b.Run(path, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _, _ = pt.Find(path)
+			}
+		})
+	}
+}
+
+func TestSeparators(t *testing.T) {
+	dot := NewPathTrieWithSeparators(".")
+	assert.NoError(t, dot.AddPath("users.{email}.profile", 1))
+	assert.NoError(t, dot.AddPath("files/{name}", 2))
+	assert.NoError(t, dot.AddPath("a\\.b.c", 3))
+	assert.NoError(t, dot.AddPath("versions.\\*.{v}", 4))
+
+	variables, value, ok := dot.Find("users.foo@bar\\.com.profile")
+	assert.True(t, ok, "find failed")
+	assert.Equal(t, 1, value, "bad value")
+	assert.Equal(t, "foo@bar.com", variables.GetOrDefault("email", ""), "escaped separator should be unescaped")
+	_, _, ok = dot.Find("users/foo/profile")
+	assert.False(t, ok, "slash should not split")
+	_, value, ok = dot.Find("files/{name}")
+	assert.True(t, ok, "find failed")
+	assert.Equal(t, 2, value, "bad value")
+	_, value, _ = dot.Find("a\\.b.c")
+	assert.Equal(t, 3, value, "bad value")
+	_, _, ok = dot.Find("a.b.c")
+	assert.False(t, ok, "should not match escaped separator")
+	variables, value, _ = dot.Find("versions.*.1\\.2")
+	assert.Equal(t, 4, value, "bad value")
+	assert.Equal(t, "1.2", variables.GetOrDefault("v", ""), "bad path var")
+	_, _, ok = dot.Find("versions.x.1")
+	assert.False(t, ok, "escaped * should be a literal")
+
+	slash := NewPathTrieWithSeparators("/")
+	assert.NoError(t, slash.AddPath("api/{version}/users", 1))
+	variables, _, ok = slash.Find("api/1.2/users")
+	assert.True(t, ok, "find failed")
+	assert.Equal(t, "1.2", variables.GetOrDefault("version", ""), "dot should not split")
+
+	prefix, ok := dot.TrimSegment("a\\.b.c.d")
+	assert.True(t, ok)
+	assert.Equal(t, "a\\.b.c", prefix)
+	prefix, ok = dot.TrimSegment(prefix)
+	assert.True(t, ok)
+	assert.Equal(t, "a\\.b", prefix)
+	_, ok = dot.TrimSegment(prefix)
+	assert.False(t, ok, "should be the only segment")
+
+	assert.Equal(t, "foo@bar\\.com", Escape("foo@bar.com", "."))
+	assert.Equal(t, "a\\\\b\\/c.d", Escape("a\\b/c.d", "/"))
+	assert.Equal(t, "a\\b/c.d", Unescape(Escape("a\\b/c.d", "./")))
+}
@@ -17,15 +17,15 @@ func (m mustErrorMono) BlockTo(ctx context.Context, _ interface{}) error {
 
 type extraMono struct {
 	mono.Mono
-	dec func([]byte, interface{}) error
+	dec FnDecodePayload
 }
 
 func (e *extraMono) BlockTo(ctx context.Context, to interface{}) (err error) {
 	pa, err := e.Block(ctx)
-	if err != nil {
+	if err != nil || pa == nil {
 		return
 	}
-	err = e.dec(pa.Data(), to)
+	err = e.dec(pa, to)
 	return
 }
 
@@ -35,7 +35,7 @@ func NewMonoWithError(err error) *mustErrorMono {
 	}
 }
 
-func NewMonoWithDecoder(origin mono.Mono, decode FnUnmarshal) *extraMono {
+func NewMonoWithDecoder(origin mono.Mono, decode FnDecodePayload) *extraMono {
 	return &extraMono{
 		Mono: origin,
 		dec:  decode,
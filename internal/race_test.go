@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package internal_test
+
+// raceEnabled reports whether the race detector is on, which makes sync.Pool drop items randomly.
+const raceEnabled = true
@@ -1,91 +1,344 @@
 package internal
 
 import (
+	"context"
+	"reflect"
+
+	reactor "github.com/jjeffcaii/reactor-go"
+	rflux "github.com/jjeffcaii/reactor-go/flux"
 	"github.com/jjeffcaii/rsocket-messaging-go/spi"
 	"github.com/pkg/errors"
+	"github.com/rsocket/rsocket-go"
 	"github.com/rsocket/rsocket-go/extension"
 	"github.com/rsocket/rsocket-go/payload"
+	"github.com/rsocket/rsocket-go/rx"
+	"github.com/rsocket/rsocket-go/rx/flux"
+)
+
+var (
+	errRequireRetrieveFlux = errors.New("stream data requires RetrieveFlux")
+	errNoMonoResponse      = errors.New("no mono in response")
+	errNoFluxResponse      = errors.New("no flux in response")
 )
 
 type requestSpec struct {
-	parent *requester
-	m      []func(*extension.CompositeMetadataBuilder) error
-	d      func() ([]byte, error)
+	parent       *requester
+	route        string
+	routeErr     error
+	m            []func() (MetadataEntry, error)
+	d            func() ([]byte, error)
+	s            func(metadata []byte) flux.Flux
+	dataMimeType string
+	accepts      []string
 }
 
 func (p *requestSpec) Metadata(metadata interface{}, mimeType string) spi.RequestSpec {
-	p.m = append(p.m, func(builder *extension.CompositeMetadataBuilder) (err error) {
-		b, err := MarshalWithMimeType(metadata, mimeType)
+	p.m = append(p.m, func() (entry MetadataEntry, err error) {
+		b, err := p.parent.codecs.Marshal(metadata, mimeType)
 		if err != nil {
 			err = errors.Wrap(err, "encode metadata failed")
 			return
 		}
-		builder.Push(mimeType, b)
+		entry = MetadataEntry{MimeType: mimeType, Content: b}
 		return
 	})
 	return p
 }
 
+func (p *requestSpec) Auth(authType string, payload []byte) spi.RequestSpec {
+	return p.auth(func() ([]byte, error) {
+		return EncodeAuth(authType, payload)
+	})
+}
+
+func (p *requestSpec) AuthSimple(username, password string) spi.RequestSpec {
+	return p.auth(func() ([]byte, error) {
+		return EncodeSimpleAuth(username, password)
+	})
+}
+
+func (p *requestSpec) AuthBearer(token string) spi.RequestSpec {
+	return p.auth(func() ([]byte, error) {
+		return EncodeBearerAuth(token)
+	})
+}
+
+func (p *requestSpec) auth(encode func() ([]byte, error)) spi.RequestSpec {
+	p.m = append(p.m, func() (entry MetadataEntry, err error) {
+		b, err := encode()
+		if err != nil {
+			err = errors.Wrap(err, "encode authentication failed")
+			return
+		}
+		entry = MetadataEntry{MimeType: extension.MessageAuthentication.String(), Content: b}
+		return
+	})
+	return p
+}
+
+func (p *requestSpec) DataMimeType(mimeType string) spi.RequestSpec {
+	p.dataMimeType = mimeType
+	return p
+}
+
+func (p *requestSpec) AcceptMimeTypes(mimeTypes ...string) spi.RequestSpec {
+	p.accepts = append(p.accepts, mimeTypes...)
+	return p
+}
+
 func (p *requestSpec) Data(data interface{}) spi.RequestSpec {
+	p.d = nil
+	p.s = nil
+	switch v := data.(type) {
+	case rx.Publisher:
+		p.s = func(metadata []byte) flux.Flux {
+			return p.mkPublisherStream(v, metadata)
+		}
+		return p
+	case rflux.Flux:
+		p.s = func(metadata []byte) flux.Flux {
+			return p.mkValueStream(v, metadata)
+		}
+		return p
+	}
+	if value := reflect.ValueOf(data); value.Kind() == reflect.Chan && value.Type().ChanDir()&reflect.RecvDir != 0 {
+		p.s = func(metadata []byte) flux.Flux {
+			return p.mkChanStream(value, metadata)
+		}
+		return p
+	}
 	p.d = func() (raw []byte, err error) {
-		return p.parent.Marshal(data)
+		return p.parent.codecs.Marshal(data, p.dataMimeType)
 	}
 	return p
 }
 
 func (p *requestSpec) Retrieve() error {
-	req, err := p.mkRequest()
-	if err != nil {
-		return err
+	if p.s != nil {
+		return errRequireRetrieveFlux
 	}
-	p.parent.socket.FireAndForget(req)
-	return nil
+	return p.execute(spi.FireAndForget).Err
 }
 
 func (p *requestSpec) RetrieveMono() spi.Mono {
-	req, err := p.mkRequest()
+	if p.s != nil {
+		return NewMonoWithError(errRequireRetrieveFlux)
+	}
+	res := p.execute(spi.RequestResponse)
+	if res.Err != nil {
+		return NewMonoWithError(res.Err)
+	}
+	if res.Mono == nil {
+		return NewMonoWithError(errNoMonoResponse)
+	}
+	return NewMonoWithDecoder(res.Mono, p.parent.Decode)
+}
+
+func (p *requestSpec) RetrieveFlux() spi.Flux {
+	typ := spi.RequestStream
+	if p.s != nil {
+		typ = spi.RequestChannel
+	}
+	res := p.execute(typ)
+	if res.Err != nil {
+		return NewFluxWithError(res.Err)
+	}
+	if res.Flux == nil {
+		return NewFluxWithError(errNoFluxResponse)
+	}
+	return NewFluxWithDecoder(res.Flux, p.parent.Decode)
+}
+
+// execute sends the request through the interceptors of requester.
+func (p *requestSpec) execute(typ spi.InteractionType) spi.Response {
+	req, err := p.mkRequest(typ)
 	if err != nil {
-		return NewMonoWithError(err)
-	}
-	res := p.parent.socket.RequestResponse(req)
-	return NewMonoWithDecoder(res, p.parent.Unmarshal)
-}
-
-func (p *requestSpec) mkRequest() (payload.Payload, error) {
-	var (
-		data     []byte
-		metadata []byte
-	)
-	if p.m != nil {
-		bu := extension.NewCompositeMetadataBuilder()
-		for _, it := range p.m {
-			if err := it(bu); err != nil {
-				return nil, err
-			}
+		return spi.Response{Err: err}
+	}
+	return p.parent.intercept(req, p.send)
+}
+
+func (p *requestSpec) send(req *spi.Request) (res spi.Response) {
+	sending, err := req.Payload()
+	if err != nil {
+		res.Err = err
+		return
+	}
+	socket := p.parent.socket
+	switch req.Type {
+	case spi.FireAndForget:
+		socket.FireAndForget(sending)
+	case spi.RequestResponse:
+		res.Mono = socket.RequestResponse(sending)
+	case spi.RequestStream:
+		res.Flux = socket.RequestStream(sending)
+	case spi.RequestChannel:
+		if p.s == nil {
+			res.Err = errors.New("no stream data for request-channel")
+			return
 		}
-		m, err := bu.Build()
+		metadata, _ := sending.Metadata()
+		res.Flux = requestChannel(socket, p.s(metadata))
+	default:
+		res.Err = errors.Errorf("unsupported interaction type: %s", req.Type)
+	}
+	return
+}
+
+func (p *requestSpec) mkRequest(typ spi.InteractionType) (*spi.Request, error) {
+	if p.routeErr != nil {
+		return nil, p.routeErr
+	}
+	req := &spi.Request{
+		Type:  typ,
+		Route: p.route,
+	}
+	for _, it := range p.m {
+		entry, err := it()
 		if err != nil {
 			return nil, err
-
 		}
-		metadata = m
+		req.Metadata = append(req.Metadata, entry)
+	}
+	if p.dataMimeType != p.parent.dataMimeType {
+		b, err := EncodeMimeType(p.dataMimeType)
+		if err != nil {
+			return nil, err
+		}
+		req.Metadata = append(req.Metadata, MetadataEntry{MimeType: extension.MessageMimeType.String(), Content: b})
+	}
+	if len(p.accepts) > 0 {
+		b, err := EncodeMimeTypes(p.accepts...)
+		if err != nil {
+			return nil, err
+		}
+		req.Metadata = append(req.Metadata, MetadataEntry{MimeType: extension.MessageAcceptMimeTypes.String(), Content: b})
 	}
 	if p.d != nil {
-		var err error
 		d, err := p.d()
 		if err != nil {
 			return nil, err
 		}
-		data = d
+		req.Data = d
 	}
-	return payload.New(data, metadata), nil
+	return req, nil
 }
 
-func (p *requestSpec) RetrieveFlux() spi.Flux {
-	req, err := p.mkRequest()
-	if err != nil {
-		return NewFluxWithError(err)
+// requestChannel sends the outbound stream by request-channel. rsocket-go (v0.5.9) panics once an outbound stream
+// fails, so it's completed instead and the error fails the inbound stream.
+func requestChannel(socket rsocket.RSocket, outbound flux.Flux) flux.Flux {
+	failed := make(chan error, 1)
+	var failure error
+	sending := NewFluxWithEmitter(func(ctx context.Context, sink flux.Sink) error {
+		if _, err := outbound.DoOnNext(sink.Next).BlockLast(ctx); err != nil && ctx.Err() == nil {
+			failure = err
+		}
+		return nil
+	})
+	// report the failure after rsocket-go has sent the COMPLETE frame.
+	inbound := socket.RequestChannel(sending.DoFinally(func(rx.SignalType) {
+		if failure != nil {
+			failed <- failure
+		}
+	}))
+	return NewFluxWithEmitter(func(ctx context.Context, sink flux.Sink) error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := inbound.DoOnNext(sink.Next).BlockLast(ctx)
+			done <- err
+		}()
+		select {
+		case err := <-failed:
+			return err
+		case err := <-done:
+			select {
+			case failure := <-failed:
+				return failure
+			default:
+				return err
+			}
+		}
+	})
+}
+
+// newStreamEncoder returns the func to encode values of a stream, payloads are sent as they are and the metadata will
+// be attached to the first one.
+func (p *requestSpec) newStreamEncoder(metadata []byte) func(interface{}) (payload.Payload, error) {
+	first := true
+	return func(v interface{}) (payload.Payload, error) {
+		var data []byte
+		if input, ok := v.(payload.Payload); ok {
+			data = input.Data()
+			if !first {
+				return input, nil
+			}
+		} else {
+			b, err := p.parent.codecs.Marshal(v, p.dataMimeType)
+			if err != nil {
+				return nil, errors.Wrap(err, "encode data failed")
+			}
+			data = b
+		}
+		if first {
+			first = false
+			return payload.New(data, metadata), nil
+		}
+		return payload.New(data, nil), nil
 	}
-	origin := p.parent.socket.RequestStream(req)
-	return NewFluxWithDecoder(origin, p.parent.Unmarshal)
+}
+
+// mkChanStream encodes every value received from the chan.
+func (p *requestSpec) mkChanStream(ch reflect.Value, metadata []byte) flux.Flux {
+	return NewFluxWithEmitter(func(ctx context.Context, sink flux.Sink) error {
+		return EmitValues(ctx, sink, ch, p.newStreamEncoder(metadata))
+	})
+}
+
+// mkValueStream encodes every value of the reactor-go flux, it's canceled if any value fails to encode.
+func (p *requestSpec) mkValueStream(values rflux.Flux, metadata []byte) flux.Flux {
+	return NewFluxWithEmitter(func(ctx context.Context, sink flux.Sink) (err error) {
+		encode := p.newStreamEncoder(metadata)
+		done, ready := make(chan struct{}), make(chan struct{})
+		var su reactor.Subscription
+		values.
+			DoFinally(func(reactor.SignalType) {
+				close(done)
+			}).
+			Subscribe(ctx,
+				reactor.OnSubscribe(func(s reactor.Subscription) {
+					su = s
+					close(ready)
+					s.Request(reactor.RequestInfinite)
+				}),
+				reactor.OnNext(func(v interface{}) {
+					next, e := encode(v)
+					if e != nil {
+						err = e
+						su.Cancel()
+						return
+					}
+					sink.Next(next)
+				}),
+				reactor.OnError(func(e error) {
+					err = e
+				}))
+		select {
+		case <-done:
+		case <-ctx.Done():
+			<-ready
+			su.Cancel()
+			<-done
+			err = ctx.Err()
+		}
+		return
+	})
+}
+
+// mkPublisherStream sends payloads of the publisher as they are, the metadata will be attached to the first one.
+func (p *requestSpec) mkPublisherStream(publisher rx.Publisher, metadata []byte) flux.Flux {
+	encode := p.newStreamEncoder(metadata)
+	return flux.Clone(publisher).Map(func(input payload.Payload) payload.Payload {
+		next, _ := encode(input)
+		return next
+	})
 }
@@ -0,0 +1,63 @@
+package internal_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	rflux "github.com/jjeffcaii/reactor-go/flux"
+	. "github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/rsocket/rsocket-go"
+	"github.com/rsocket/rsocket-go/payload"
+	"github.com/rsocket/rsocket-go/rx"
+	"github.com/rsocket/rsocket-go/rx/flux"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoSocket echoes request-channel payloads and records whether each one carries metadata.
+type echoSocket struct {
+	mu       sync.Mutex
+	metadata []bool
+}
+
+func (s *echoSocket) requestChannel(msgs rx.Publisher) flux.Flux {
+	return flux.Clone(msgs).Map(func(input payload.Payload) payload.Payload {
+		_, ok := input.Metadata()
+		s.mu.Lock()
+		s.metadata = append(s.metadata, ok)
+		s.mu.Unlock()
+		return payload.New(input.Data(), nil)
+	})
+}
+
+func TestRequestSpec_Channel(t *testing.T) {
+	echo := &echoSocket{}
+	requester := NewRequester(rsocket.NewAbstractSocket(rsocket.RequestChannel(echo.requestChannel)), "application/json", nil)
+
+	values := rflux.Just(Message{ID: 1}, payload.NewString(`{"id":2}`, ""), Message{ID: 3})
+	var messages []Message
+	err := requester.Route("messages").Data(values).RetrieveFlux().BlockToSlice(context.Background(), &messages)
+	assert.NoError(t, err, "request channel failed")
+	assert.Equal(t, []Message{{ID: 1}, {ID: 2}, {ID: 3}}, messages, "bad result")
+	assert.Equal(t, []bool{true, false, false}, echo.metadata, "metadata should be attached to the first one")
+
+	ch := make(chan interface{}, 3)
+	ch <- Message{ID: 4}
+	ch <- payload.NewString(`{"id":5}`, "")
+	close(ch)
+	messages = nil
+	err = requester.Route("messages").Data(ch).RetrieveFlux().BlockToSlice(context.Background(), &messages)
+	assert.NoError(t, err, "request channel failed")
+	assert.Equal(t, []Message{{ID: 4}, {ID: 5}}, messages, "bad result")
+
+	failing := make(chan interface{}, 2)
+	failing <- Message{ID: 6}
+	failing <- func() {}
+	close(failing)
+	err = requester.Route("messages").Data(failing).RetrieveFlux().BlockToSlice(context.Background(), &messages)
+	assert.Error(t, err, "should fail to encode")
+	assert.Contains(t, err.Error(), "encode data failed", "bad error")
+
+	err = requester.Route("messages").Data(rflux.Just(func() {})).RetrieveFlux().BlockToSlice(context.Background(), &messages)
+	assert.Error(t, err, "should fail to encode")
+}
@@ -1,32 +1,39 @@
 package internal
 
 import (
-	"fmt"
-
 	"github.com/jjeffcaii/rsocket-messaging-go/spi"
 	"github.com/rsocket/rsocket-go"
 	"github.com/rsocket/rsocket-go/extension"
+	"github.com/rsocket/rsocket-go/payload"
 )
 
 type requester struct {
 	dataMimeType string
 	socket       rsocket.RSocket
+	codecs       *CodecRegistry
+	interceptors []spi.Interceptor
 }
 
+// Route creates a request of the route template, the error of a bad template is returned when it's retrieved.
 func (p *requester) Route(route string, args ...interface{}) spi.RequestSpec {
+	expanded, err := ExpandRoute(route, args...)
 	return &requestSpec{
-		parent: p,
-		m: []func(*extension.CompositeMetadataBuilder) error{
-			func(builder *extension.CompositeMetadataBuilder) (err error) {
-				b, err := extension.EncodeRouting(fmt.Sprintf(route, args...))
-				if err != nil {
-					return
-				}
-				builder.PushWellKnown(extension.MessageRouting, b)
-				return
-			},
-		},
+		parent:       p,
+		route:        expanded,
+		routeErr:     err,
+		dataMimeType: p.dataMimeType,
+	}
+}
+
+// intercept invokes the interceptors in order, the last one calls the invoker.
+func (p *requester) intercept(req *spi.Request, invoker spi.Invoker) spi.Response {
+	for i := len(p.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := p.interceptors[i], invoker
+		invoker = func(req *spi.Request) spi.Response {
+			return interceptor(req, next)
+		}
 	}
+	return invoker(req)
 }
 
 func (p *requester) Close() (err error) {
@@ -37,16 +44,34 @@ func (p *requester) Close() (err error) {
 }
 
 func (p *requester) Unmarshal(raw []byte, v interface{}) error {
-	return UnmarshalWithMimeType(raw, v, p.dataMimeType)
+	return p.codecs.Unmarshal(raw, v, p.dataMimeType)
+}
+
+// Decode decodes the payload with the mime type reported in its metadata, or the data mime type of connection.
+func (p *requester) Decode(input payload.Payload, v interface{}) error {
+	mimeType := p.dataMimeType
+	if raw, ok := input.Metadata(); ok {
+		if entries, err := ParseMetadata(raw, extension.MessageCompositeMetadata.String()); err == nil {
+			if found, ok := entries.MimeType(); ok {
+				mimeType = found
+			}
+		}
+	}
+	return p.codecs.Unmarshal(input.Data(), v, mimeType)
 }
 
 func (p *requester) Marshal(v interface{}) ([]byte, error) {
-	return MarshalWithMimeType(v, p.dataMimeType)
+	return p.codecs.Marshal(v, p.dataMimeType)
 }
 
-func NewRequester(socket rsocket.RSocket, dataMimeType string) *requester {
+func NewRequester(socket rsocket.RSocket, dataMimeType string, codecs *CodecRegistry, interceptors ...spi.Interceptor) *requester {
+	if codecs == nil {
+		codecs = DefaultCodecRegistry
+	}
 	return &requester{
 		dataMimeType: dataMimeType,
 		socket:       socket,
+		codecs:       codecs,
+		interceptors: interceptors,
 	}
 }
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExpandRoute fills the route template with args.
+// A template like "student.v1.{id}" accepts the same variables as PathTrie: args can be a map with string keys or a
+// struct, whose fields are matched by the "route" tag or the name ignoring case, or the values of variables by order.
+// Values are escaped so they can't inject separators, except the one of {*name}, and the one of {name:regex} must
+// match the regex. A template without variables is formatted by fmt.Sprintf for compatibility, and it fails if any
+// verb is left unfilled, even without args.
+func ExpandRoute(template string, args ...interface{}) (string, error) {
+	tokens, err := parseRouteTemplate(template)
+	if err != nil {
+		return "", err
+	}
+	variables := 0
+	for _, it := range tokens {
+		if it.variable {
+			variables++
+		}
+	}
+	if variables == 0 {
+		return sprintfRoute(template, args...)
+	}
+	lookup, err := newRouteValues(variables, args)
+	if err != nil {
+		return "", errors.Wrapf(err, "expand route %s failed", template)
+	}
+	var b strings.Builder
+	cur := 0
+	for _, it := range tokens {
+		if !it.variable {
+			b.WriteString(it.text)
+			continue
+		}
+		value, err := lookup(it.name, cur)
+		cur++
+		var s string
+		if err == nil {
+			s, err = it.render(value)
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "expand route %s failed", template)
+		}
+		b.WriteString(s)
+	}
+	return b.String(), nil
+}
+
+// routeToken is a literal part or a variable of route template.
+type routeToken struct {
+	text     string
+	variable bool
+	name     string
+	rest     bool
+	regex    *regexp.Regexp
+}
+
+func (t routeToken) render(value interface{}) (string, error) {
+	s, err := formatRouteValue(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "bad value of {%s}", t.name)
+	}
+	if s == "" {
+		return "", errors.Errorf("empty value of {%s}", t.name)
+	}
+	if t.regex != nil && !t.regex.MatchString(s) {
+		return "", errors.Errorf("value %q of {%s} doesn't match %s", s, t.name, t.regex)
+	}
+	if t.rest {
+		return s, nil
+	}
+	return Escape(s, DefaultSeparators), nil
+}
+
+func parseRouteTemplate(template string) (tokens []routeToken, err error) {
+	start := 0
+	for i := 0; i < len(template); i++ {
+		switch template[i] {
+		case '\\':
+			i++
+		case '}':
+			return nil, errors.Errorf("bad route template %s: unexpected } at %d", template, i)
+		case '{':
+			end, depth := i+1, 1
+			for ; end < len(template) && depth > 0; end++ {
+				switch template[end] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+			}
+			if depth > 0 {
+				return nil, errors.Errorf("bad route template %s: unclosed { at %d", template, i)
+			}
+			token := routeToken{
+				text:     template[i:end],
+				variable: true,
+			}
+			switch seg := parseSegment(token.text); seg.kind {
+			case segmentVariable:
+				token.name = seg.name
+			case segmentCaptureRest:
+				token.name, token.rest = seg.name, true
+			case segmentConstrained:
+				token.name = seg.name
+				if token.regex, err = regexp.Compile("^(?:" + seg.regex + ")$"); err != nil {
+					return nil, errors.Wrapf(err, "bad regex of variable %s", seg.name)
+				}
+			default:
+				return nil, errors.Errorf("bad route template %s: bad variable %s", template, token.text)
+			}
+			if start < i {
+				tokens = append(tokens, routeToken{text: template[start:i]})
+			}
+			tokens = append(tokens, token)
+			start = end
+			i = end - 1
+		}
+	}
+	if start < len(template) {
+		tokens = append(tokens, routeToken{text: template[start:]})
+	}
+	return
+}
+
+func sprintfRoute(template string, args ...interface{}) (string, error) {
+	if len(args) == 0 && !hasVerb(template) {
+		return template, nil
+	}
+	route, err := MkString(template, args...)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(route, "%!") {
+		return "", errors.Errorf("bad route template %s: arguments don't match verbs, got %s", template, route)
+	}
+	return route, nil
+}
+
+// hasVerb returns true if the template contains any printf verb, a trailing '%' is not a verb.
+func hasVerb(template string) bool {
+	i := strings.IndexByte(template, '%')
+	return i >= 0 && i < len(template)-1
+}
+
+// newRouteValues returns the func to lookup value of a variable by name or index.
+func newRouteValues(variables int, args []interface{}) (func(name string, i int) (interface{}, error), error) {
+	if len(args) == 1 {
+		v := reflect.Indirect(reflect.ValueOf(args[0]))
+		_, stringer := args[0].(fmt.Stringer)
+		switch {
+		case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+			return func(name string, _ int) (interface{}, error) {
+				found := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+				if !found.IsValid() {
+					return nil, errors.Errorf("missing value of {%s}", name)
+				}
+				return found.Interface(), nil
+			}, nil
+		case v.Kind() == reflect.Struct && !stringer:
+			return func(name string, _ int) (interface{}, error) {
+				for i := 0; i < v.NumField(); i++ {
+					field := v.Type().Field(i)
+					if field.PkgPath != "" {
+						continue
+					}
+					if tag, ok := field.Tag.Lookup("route"); ok && tag == name || !ok && strings.EqualFold(field.Name, name) {
+						return v.Field(i).Interface(), nil
+					}
+				}
+				return nil, errors.Errorf("missing value of {%s}", name)
+			}, nil
+		}
+	}
+	if len(args) != variables {
+		return nil, errors.Errorf("require %d values of variables, got %d", variables, len(args))
+	}
+	return func(_ string, i int) (interface{}, error) {
+		return args[i], nil
+	}, nil
+}
+
+func formatRouteValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return fmt.Sprint(value), nil
+	default:
+		return "", errors.Errorf("unsupported type %T", value)
+	}
+}
@@ -0,0 +1,72 @@
+package internal_test
+
+import (
+	"testing"
+
+	. "github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+type routeID int
+
+func (r routeID) String() string {
+	return "#" + string(rune('0'+r))
+}
+
+func TestExpandRoute(t *testing.T) {
+	for _, it := range []struct {
+		template string
+		args     []interface{}
+		expect   string
+	}{
+		{"student.v1.{id}", []interface{}{42}, "student.v1.42"},
+		{"student.{version}.{id}", []interface{}{"v1", uint8(7)}, "student.v1.7"},
+		{"student.v1.{id}", []interface{}{map[string]interface{}{"id": 1}}, "student.v1.1"},
+		{"student.v1.{id}", []interface{}{map[string]string{"id": "foo"}}, "student.v1.foo"},
+		{"student.{Version}.{id}", []interface{}{struct {
+			Version string
+			No      int `route:"id"`
+			ID      int
+		}{"v2", 3, 4}}, "student.v2.3"},
+		{"student.v1.{id}", []interface{}{&struct{ ID routeID }{5}}, "student.v1.#5"},
+		{"users.{email}.profile", []interface{}{"foo@bar.com"}, "users.foo@bar\\.com.profile"},
+		{"users.{name}", []interface{}{"a/b\\c"}, "users.a\\/b\\\\c"},
+		{"files.{*path}", []interface{}{"a/b.txt"}, "files.a/b.txt"},
+		{"student.v1.{id:[0-9]+}", []interface{}{12}, "student.v1.12"},
+		{"student.v1.%d", []interface{}{42}, "student.v1.42"},
+		{"student.v1.upsert", nil, "student.v1.upsert"},
+		{"100%", nil, "100%"},
+		{"100%%.%d", []interface{}{1}, "100%.1"},
+	} {
+		route, err := ExpandRoute(it.template, it.args...)
+		assert.NoError(t, err, "expand %s failed", it.template)
+		assert.Equal(t, it.expect, route, "bad route of %s", it.template)
+	}
+
+	for _, it := range []struct {
+		template string
+		args     []interface{}
+		err      string
+	}{
+		{"student.v1.%d", nil, "arguments don't match verbs"},
+		{"student.%s.%d", nil, "arguments don't match verbs"},
+		{"student.v1.%d", []interface{}{"a", "b"}, "arguments don't match verbs"},
+		{"student.v1.%d.%d", []interface{}{1}, "arguments don't match verbs"},
+		{"student.v1.{id}", nil, "require 1 values of variables, got 0"},
+		{"student.{version}.{id}", []interface{}{"v1"}, "require 2 values of variables, got 1"},
+		{"student.v1.{id}", []interface{}{map[string]int{"no": 1}}, "missing value of {id}"},
+		{"student.v1.{id}", []interface{}{struct{ No int }{1}}, "missing value of {id}"},
+		{"student.v1.{id}", []interface{}{""}, "empty value of {id}"},
+		{"student.v1.{id}", []interface{}{[]int{1}}, "bad value of {id}: unsupported type []int"},
+		{"student.v1.{id:[0-9]+}", []interface{}{"abc"}, `value "abc" of {id} doesn't match`},
+		{"student.v1.{id", nil, "unclosed {"},
+		{"student.v1.id}", nil, "unexpected }"},
+		{"student.v1.{1d}", []interface{}{1}, "bad variable {1d}"},
+	} {
+		_, err := ExpandRoute(it.template, it.args...)
+		assert.Error(t, err, "expand %s should fail", it.template)
+		if err != nil {
+			assert.Contains(t, err.Error(), it.err, "bad error of %s", it.template)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package messaging
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+var errLoopbackStopped = errors.New("loopback responder stopped")
+
+// Loopback is an in-process responder listening on a unix socket in a temporary directory. Requesters connect to it
+// by RequestBuilder.ConnectLoopback, so routing, codecs and all interaction models can be tested without external
+// servers or TCP ports.
+type Loopback struct {
+	dir    string
+	path   string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Path returns the path of the unix socket.
+func (l *Loopback) Path() string {
+	return l.path
+}
+
+// Close stops the responder, waits until it exits and removes the temporary directory.
+func (l *Loopback) Close() error {
+	l.cancel()
+	<-l.done
+	return os.RemoveAll(l.dir)
+}
+
+// ServeLoopback serves in background on a unix socket in a new temporary directory, and returns when the responder is
+// ready. The listening address set by ListenTCP is ignored, and the responder stops when ctx is done or the Loopback
+// is closed.
+func (b *ServerBuilder) ServeLoopback(ctx context.Context) (*Loopback, error) {
+	if b.router == nil {
+		return nil, errNoRouter
+	}
+	dir, err := ioutil.TempDir("", "rsocket-messaging")
+	if err != nil {
+		return nil, errors.Wrap(err, "serve loopback failed")
+	}
+	l, err := b.serveLoopback(ctx, dir)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "serve loopback failed")
+	}
+	return l, nil
+}
+
+func (b *ServerBuilder) serveLoopback(ctx context.Context, dir string) (*Loopback, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	l := &Loopback{
+		dir:    dir,
+		path:   filepath.Join(dir, "loopback.sock"),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	server := *b
+	server.tpUrl = "unix://" + l.path
+	server.onStart = append(b.onStart[:len(b.onStart):len(b.onStart)], func() {
+		close(started)
+	})
+	go func() {
+		defer close(l.done)
+		stopped <- server.Serve(ctx)
+	}()
+	select {
+	case <-started:
+		return l, nil
+	case err := <-stopped:
+		cancel()
+		if err == nil {
+			err = errLoopbackStopped
+		}
+		return nil, err
+	}
+}
+
+// ConnectLoopback connects to the in-process responder.
+func (b *RequestBuilder) ConnectLoopback(l *Loopback) *RequestBuilder {
+	b.tpUrl = "unix://" + l.path
+	return b
+}
@@ -0,0 +1,39 @@
+package messaging_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeLoopback(t *testing.T) {
+	_, err := messaging.Server().ServeLoopback(context.Background())
+	assert.Error(t, err, "should fail without router")
+
+	loopback, err := messaging.Server().Router(newStudentRouter()).ServeLoopback(context.Background())
+	assert.NoError(t, err, "serve failed")
+
+	requester, err := messaging.Builder().ConnectLoopback(loopback).Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+
+	var student Student
+	err = requester.Route("student.v1.{id}", 7).RetrieveMono().BlockTo(context.Background(), &student)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, 7, student.ID, "bad result")
+
+	var students []Student
+	err = requester.Route("students.v1").RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request failed")
+	assert.Len(t, students, 10, "bad result")
+
+	_ = requester.Close()
+	assert.NoError(t, loopback.Close(), "close failed")
+	_, err = os.Stat(filepath.Dir(loopback.Path()))
+	assert.True(t, os.IsNotExist(err), "temporary directory should be removed")
+	_, err = messaging.Builder().ConnectLoopback(loopback).Build(context.Background())
+	assert.Error(t, err, "should be closed")
+}
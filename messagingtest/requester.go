@@ -0,0 +1,284 @@
+package messagingtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/jjeffcaii/rsocket-messaging-go/spi"
+	"github.com/pkg/errors"
+	"github.com/rsocket/rsocket-go"
+	"github.com/rsocket/rsocket-go/extension"
+	"github.com/rsocket/rsocket-go/payload"
+	"github.com/rsocket/rsocket-go/rx"
+	"github.com/rsocket/rsocket-go/rx/flux"
+	"github.com/rsocket/rsocket-go/rx/mono"
+)
+
+var errNoChannelData = errors.New("no data in request-channel")
+
+// TestingT is the part of testing.TB used by Requester.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// Expectation is an expected request of a route pattern.
+type Expectation struct {
+	pattern  string
+	trie     *internal.PathTrie
+	response *Response
+	times    int
+	calls    int
+}
+
+// Times sets how many requests are expected, it's 1 by default and a negative n means any times.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) exhausted() bool {
+	return e.times >= 0 && e.calls >= e.times
+}
+
+// Requester is an in-memory spi.Requester for unit tests of the code calling it, no socket is involved.
+// Requests are built by the real spi.RequestSpec, and the scripted responses of expectations are encoded and decoded
+// by the real codecs. Unmet expectations and unexpected requests are reported when the test finishes.
+type Requester struct {
+	requester    spi.Requester
+	codecs       *messaging.CodecRegistry
+	dataMimeType string
+	mu           sync.Mutex
+	expectations []*Expectation
+	requests     []Request
+	unexpected   []string
+}
+
+// Expect expects a request of route pattern, which can be any pattern supported by messaging.Router.
+// Expectations are matched by order, and an exhausted one is skipped.
+func (r *Requester) Expect(pattern string, response *Response) (*Expectation, error) {
+	e := &Expectation{
+		pattern:  pattern,
+		trie:     internal.NewPathTrie(),
+		response: response,
+		times:    1,
+	}
+	if err := e.trie.AddPath(pattern, e); err != nil {
+		return nil, errors.Wrapf(err, "bad pattern %s", pattern)
+	}
+	r.mu.Lock()
+	r.expectations = append(r.expectations, e)
+	r.mu.Unlock()
+	return e, nil
+}
+
+func (r *Requester) Route(route string, args ...interface{}) spi.RequestSpec {
+	return r.requester.Route(route, args...)
+}
+
+func (r *Requester) Close() error {
+	return nil
+}
+
+// Requests returns all received requests by order, including the unexpected ones.
+func (r *Requester) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Request(nil), r.requests...)
+}
+
+// Verify returns an error if any expectation is unmet or any request is unexpected.
+func (r *Requester) Verify() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var problems []string
+	for _, it := range r.expectations {
+		if it.calls < it.times {
+			problems = append(problems, fmt.Sprintf("expect %d requests of %s, got %d", it.times, it.pattern, it.calls))
+		}
+	}
+	for _, it := range r.unexpected {
+		problems = append(problems, fmt.Sprintf("unexpected request %s", it))
+	}
+	if len(problems) < 1 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// receive records the request, and returns the matched response with the negotiated mime type.
+func (r *Requester) receive(msg payload.Payload) (mimeType string, response *Response, err error) {
+	raw, _ := msg.Metadata()
+	entries, err := internal.ParseMetadata(raw, extension.MessageCompositeMetadata.String())
+	if err != nil {
+		return
+	}
+	route, err := entries.Route()
+	if err != nil {
+		return
+	}
+	req := Request{
+		Route:        route,
+		Metadata:     append([]spi.MetadataEntry(nil), entries...),
+		Data:         append([]byte(nil), msg.Data()...),
+		DataMimeType: r.dataMimeType,
+		codecs:       r.codecs,
+	}
+	if found, ok := entries.MimeType(); ok {
+		req.DataMimeType = found
+	}
+	mimeType = r.codecs.Negotiate(req.DataMimeType, entries.AcceptMimeTypes())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	for _, it := range r.expectations {
+		if it.exhausted() {
+			continue
+		}
+		if _, _, ok := it.trie.Find(route); ok {
+			it.calls++
+			response = it.response
+			return
+		}
+	}
+	r.unexpected = append(r.unexpected, route)
+	err = errors.Errorf("unexpected request %s", route)
+	return
+}
+
+func (r *Requester) encode(mimeType string, v interface{}) (payload.Payload, error) {
+	return r.codecs.EncodeResponse(v, mimeType, r.dataMimeType, extension.MessageCompositeMetadata.String())
+}
+
+func (r *Requester) fireAndForget(msg payload.Payload) {
+	// the error of an unexpected request is reported by Verify
+	_, _, _ = r.receive(msg)
+}
+
+func (r *Requester) requestResponse(msg payload.Payload) mono.Mono {
+	mimeType, response, err := r.receive(msg)
+	if err != nil {
+		return mono.Error(err)
+	}
+	return mono.Create(func(ctx context.Context, sink mono.Sink) {
+		if !sleep(ctx, response.delay) {
+			sink.Error(ctx.Err())
+			return
+		}
+		if response.err != nil {
+			sink.Error(response.err)
+			return
+		}
+		if response.stream {
+			sink.Error(errors.New("cannot respond a stream for request-response"))
+			return
+		}
+		if response.value == nil {
+			sink.Success(nil)
+			return
+		}
+		res, err := r.encode(mimeType, response.value)
+		if err != nil {
+			sink.Error(err)
+			return
+		}
+		sink.Success(res)
+	})
+}
+
+func (r *Requester) requestStream(msg payload.Payload) flux.Flux {
+	mimeType, response, err := r.receive(msg)
+	if err != nil {
+		return flux.Error(err)
+	}
+	return internal.NewFluxWithEmitter(func(ctx context.Context, sink flux.Sink) error {
+		return r.emit(ctx, mimeType, response, sink)
+	})
+}
+
+func (r *Requester) emit(ctx context.Context, mimeType string, response *Response, sink flux.Sink) error {
+	if !sleep(ctx, response.delay) {
+		return ctx.Err()
+	}
+	if response.err != nil {
+		return response.err
+	}
+	items := response.items
+	if !response.stream && response.value != nil {
+		items = []interface{}{response.value}
+	}
+	return internal.EmitValues(ctx, sink, reflect.ValueOf(items), func(v interface{}) (payload.Payload, error) {
+		return r.encode(mimeType, v)
+	})
+}
+
+// requestChannel receives the request by the first payload of msgs, and responds like a request-stream. Following
+// payloads are discarded, and msgs is canceled once the response finishes.
+func (r *Requester) requestChannel(msgs rx.Publisher) flux.Flux {
+	return internal.NewFluxWithEmitter(func(ctx context.Context, sink flux.Sink) error {
+		first := make(chan payload.Payload, 1)
+		done := make(chan error, 1)
+		go func() {
+			var received bool
+			_, err := flux.Clone(msgs).
+				DoOnNext(func(input payload.Payload) {
+					if !received {
+						received = true
+						first <- payload.Clone(input)
+					}
+				}).
+				BlockLast(ctx)
+			done <- err
+		}()
+		var msg payload.Payload
+		select {
+		case msg = <-first:
+		case err := <-done:
+			select {
+			case msg = <-first:
+			default:
+				if err == nil {
+					err = errNoChannelData
+				}
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		mimeType, response, err := r.receive(msg)
+		if err != nil {
+			return err
+		}
+		return r.emit(ctx, mimeType, response, sink)
+	})
+}
+
+// NewRequester creates a fake requester with the codecs, or the default codec registry if it's nil.
+// The data mime type is application/json like messaging.Builder, and Verify is called when the test finishes.
+func NewRequester(t TestingT, codecs *messaging.CodecRegistry) *Requester {
+	if codecs == nil {
+		codecs = messaging.DefaultCodecRegistry()
+	}
+	r := &Requester{
+		codecs:       codecs,
+		dataMimeType: extension.ApplicationJSON.String(),
+	}
+	socket := rsocket.NewAbstractSocket(
+		rsocket.FireAndForget(r.fireAndForget),
+		rsocket.RequestResponse(r.requestResponse),
+		rsocket.RequestStream(r.requestStream),
+		rsocket.RequestChannel(r.requestChannel),
+	)
+	r.requester = internal.NewRequester(socket, r.dataMimeType, codecs)
+	t.Cleanup(func() {
+		if err := r.Verify(); err != nil {
+			t.Errorf("%s", err)
+		}
+	})
+	return r
+}
@@ -0,0 +1,137 @@
+package messagingtest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	rflux "github.com/jjeffcaii/reactor-go/flux"
+	"github.com/jjeffcaii/rsocket-messaging-go/messagingtest"
+	"github.com/jjeffcaii/rsocket-messaging-go/spi"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeT struct {
+	errors  []string
+	cleanup []func()
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Cleanup(fn func()) {
+	t.cleanup = append(t.cleanup, fn)
+}
+
+func (t *fakeT) finish() {
+	for i := len(t.cleanup) - 1; i >= 0; i-- {
+		t.cleanup[i]()
+	}
+}
+
+// studentName is the calling code under test.
+func studentName(requester spi.Requester, id int) (string, error) {
+	var student Student
+	if err := requester.Route("student.v1.{id}", id).RetrieveMono().BlockTo(context.Background(), &student); err != nil {
+		return "", err
+	}
+	return student.Name, nil
+}
+
+func TestRequester(t *testing.T) {
+	requester := messagingtest.NewRequester(t, nil)
+	e, err := requester.Expect("student.v1.{id}", messagingtest.Value(Student{ID: 1, Name: "foo"}))
+	assert.NoError(t, err, "expect failed")
+	e.Times(2)
+	expect(t, requester, "students.v1", messagingtest.Stream(Student{ID: 1}, Student{ID: 2}))
+	expect(t, requester, "student.v1.fail", messagingtest.Error(errors.New("boom")))
+	expect(t, requester, "student.v1.noop", messagingtest.Empty())
+	expect(t, requester, "student.v1.cbor", messagingtest.Value(Student{ID: 3}))
+
+	for i := 0; i < 2; i++ {
+		name, err := studentName(requester, 1)
+		assert.NoError(t, err, "request failed")
+		assert.Equal(t, "foo", name, "bad result")
+	}
+
+	var students []Student
+	err = requester.Route("students.v1").RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, []Student{{ID: 1}, {ID: 2}}, students, "bad result")
+
+	var student Student
+	err = requester.Route("student.v1.fail").RetrieveMono().BlockTo(context.Background(), &student)
+	assert.EqualError(t, err, "boom", "bad error")
+
+	assert.NoError(t, requester.Route("student.v1.noop").Data(Student{ID: 4}).Retrieve())
+
+	err = requester.Route("student.v1.cbor").
+		AcceptMimeTypes("application/cbor").
+		RetrieveMono().
+		BlockTo(context.Background(), &student)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, 3, student.ID, "bad result")
+
+	requests := requester.Requests()
+	assert.Len(t, requests, 6, "bad requests")
+	assert.Equal(t, "student.v1.noop", requests[4].Route, "bad route")
+	assert.NoError(t, requests[4].BindData(&student))
+	assert.Equal(t, 4, student.ID, "bad data")
+	assert.NoError(t, requester.Verify())
+}
+
+func TestRequester_Verify(t *testing.T) {
+	ft := &fakeT{}
+	requester := messagingtest.NewRequester(ft, nil)
+	expect(t, requester, "student.v1.{id}", messagingtest.Value(Student{ID: 1}))
+	expect(t, requester, "students.v1", messagingtest.Stream())
+	e, err := requester.Expect("student.v1.any", messagingtest.Empty())
+	assert.NoError(t, err, "expect failed")
+	e.Times(-1)
+	_, err = requester.Expect("students.**.scores", messagingtest.Empty())
+	assert.Error(t, err, "should be a bad pattern")
+
+	_, err = studentName(requester, 1)
+	assert.NoError(t, err, "request failed")
+	_, err = studentName(requester, 2)
+	assert.EqualError(t, err, "unexpected request student.v1.2", "should be exhausted")
+	assert.NoError(t, requester.Route("not.exist").Retrieve())
+
+	ft.finish()
+	assert.Equal(t, []string{
+		"expect 1 requests of students.v1, got 0; unexpected request student.v1.2; unexpected request not.exist",
+	}, ft.errors, "bad verification")
+}
+
+func TestRequester_Channel(t *testing.T) {
+	requester := messagingtest.NewRequester(t, nil)
+	expect(t, requester, "students.v1.echo", messagingtest.Stream(Student{ID: 1}, Student{ID: 2}))
+	expect(t, requester, "students.v1.fail", messagingtest.Error(errors.New("boom")))
+
+	outbound := make(chan Student, 2)
+	outbound <- Student{ID: 3}
+	outbound <- Student{ID: 4}
+	close(outbound)
+	var students []Student
+	err := requester.Route("students.v1.echo").Data(outbound).RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, []Student{{ID: 1}, {ID: 2}}, students, "bad result")
+
+	err = requester.Route("students.v1.fail").Data(rflux.Just(Student{ID: 5})).RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.EqualError(t, err, "boom", "bad error")
+
+	requests := requester.Requests()
+	assert.Len(t, requests, 2, "bad requests")
+	var student Student
+	assert.NoError(t, requests[0].BindData(&student))
+	assert.Equal(t, 3, student.ID, "the first value should be the request data")
+	assert.NoError(t, requests[1].BindData(&student))
+	assert.Equal(t, 5, student.ID, "the first value should be the request data")
+}
+
+func expect(t *testing.T, requester *messagingtest.Requester, pattern string, response *messagingtest.Response) {
+	_, err := requester.Expect(pattern, response)
+	assert.NoError(t, err, "expect failed")
+}
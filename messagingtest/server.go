@@ -0,0 +1,232 @@
+// Package messagingtest provides utilities for testing RSocket messaging requesters.
+package messagingtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/jjeffcaii/rsocket-messaging-go/spi"
+	"github.com/pkg/errors"
+)
+
+// Response is a scripted response of a route pattern.
+type Response struct {
+	value  interface{}
+	items  []interface{}
+	stream bool
+	err    error
+	delay  time.Duration
+}
+
+// Value responds a single value, it's also a stream of one item for request-stream.
+func Value(value interface{}) *Response {
+	return &Response{
+		value: value,
+	}
+}
+
+// Stream responds the items as a stream, it's only for request-stream.
+func Stream(items ...interface{}) *Response {
+	return &Response{
+		items:  items,
+		stream: true,
+	}
+}
+
+// Error fails the request with the error, which is sent as an APPLICATION_ERROR.
+func Error(err error) *Response {
+	return &Response{
+		err: err,
+	}
+}
+
+// Empty completes the request without any value.
+func Empty() *Response {
+	return &Response{}
+}
+
+// Delay waits before responding, and a request-stream waits before the first item.
+func (r *Response) Delay(delay time.Duration) *Response {
+	r.delay = delay
+	return r
+}
+
+func (r *Response) handle(c *messaging.RouteContext) error {
+	if r.stream && r.err == nil {
+		items := make(chan interface{})
+		go func() {
+			defer close(items)
+			if !sleep(c.Context(), r.delay) {
+				return
+			}
+			for _, it := range r.items {
+				select {
+				case items <- it:
+				case <-c.Context().Done():
+					return
+				}
+			}
+		}()
+		return c.RespondStream(items)
+	}
+	if !sleep(c.Context(), r.delay) {
+		return c.Context().Err()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if r.value == nil {
+		return nil
+	}
+	return c.Respond(r.value)
+}
+
+func sleep(ctx context.Context, delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Request is a request received by the Server.
+type Request struct {
+	Route string
+	// Metadata contains all entries of composite metadata by order, including the routing one.
+	Metadata     []spi.MetadataEntry
+	Data         []byte
+	DataMimeType string
+	codecs       *messaging.CodecRegistry
+}
+
+// BindData decodes the data with the data mime type of request.
+func (r Request) BindData(to interface{}) error {
+	return r.codecs.Unmarshal(r.Data, to, r.DataMimeType)
+}
+
+// BindMetadata decodes the first metadata entry of given mime type.
+func (r Request) BindMetadata(mimeType string, to interface{}) error {
+	for _, it := range r.Metadata {
+		if it.MimeType == mimeType {
+			return r.codecs.Unmarshal(it.Content, to, mimeType)
+		}
+	}
+	return errors.Errorf("no such metadata: %s", mimeType)
+}
+
+// Server is a mock responder on a loopback unix socket. Responses are scripted by route patterns, and all received
+// requests are recorded, including the ones without matched pattern which fail with an error.
+type Server struct {
+	loopback *messaging.Loopback
+	router   *messaging.Router
+	codecs   *messaging.CodecRegistry
+	mu       sync.Mutex
+	requests []Request
+	notify   chan struct{}
+}
+
+// On scripts the response of route pattern, which can be any pattern supported by messaging.Router.
+// The response of a pattern scripted before is replaced.
+func (s *Server) On(pattern string, response *Response) error {
+	return s.router.Replace(pattern, response.handle)
+}
+
+// Requests returns all received requests by order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Wait blocks until n requests have been received, it's useful for fire-and-forget requests which are handled
+// asynchronously.
+func (s *Server) Wait(ctx context.Context, n int) ([]Request, error) {
+	for {
+		s.mu.Lock()
+		requests, notify := s.requests, s.notify
+		s.mu.Unlock()
+		if len(requests) >= n {
+			return append([]Request(nil), requests...), nil
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "wait for %d requests, got %d", n, len(requests))
+		}
+	}
+}
+
+// Reset clears received requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	s.requests = nil
+	s.mu.Unlock()
+}
+
+// Path returns the path of the listening unix socket.
+func (s *Server) Path() string {
+	return s.loopback.Path()
+}
+
+// Requester connects to the server with the builder, or a default one if it's nil.
+func (s *Server) Requester(ctx context.Context, builder *messaging.RequestBuilder) (spi.Requester, error) {
+	if builder == nil {
+		builder = messaging.Builder()
+	}
+	return builder.ConnectLoopback(s.loopback).Build(ctx)
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.loopback.Close()
+}
+
+func (s *Server) record(next messaging.RouteHandler) messaging.RouteHandler {
+	return func(c *messaging.RouteContext) error {
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{
+			Route:        c.Route(),
+			Metadata:     c.MetadataEntries(),
+			Data:         append([]byte(nil), c.Data()...),
+			DataMimeType: c.DataMimeType(),
+			codecs:       s.codecs,
+		})
+		close(s.notify)
+		s.notify = make(chan struct{})
+		s.mu.Unlock()
+		return next(c)
+	}
+}
+
+// NewServer starts a mock responder with the codecs, or the default codec registry if it's nil.
+func NewServer(codecs *messaging.CodecRegistry) (*Server, error) {
+	if codecs == nil {
+		codecs = messaging.DefaultCodecRegistry()
+	}
+	s := &Server{
+		router: messaging.NewRouter(),
+		codecs: codecs,
+		notify: make(chan struct{}),
+	}
+	s.router.Use(s.record)
+	_ = s.router.NotFound(func(c *messaging.RouteContext) error {
+		return errors.Errorf("no scripted response for %s", c.Route())
+	})
+	loopback, err := messaging.Server().
+		Router(s.router).
+		CodecRegistry(codecs).
+		ServeLoopback(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	s.loopback = loopback
+	return s, nil
+}
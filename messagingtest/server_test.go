@@ -0,0 +1,90 @@
+package messagingtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/jjeffcaii/rsocket-messaging-go/messagingtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type Student struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestServer(t *testing.T) {
+	server, err := messagingtest.NewServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	assert.NoError(t, server.On("student.v1.{id}", messagingtest.Value(Student{ID: 1, Name: "foo"})))
+	assert.NoError(t, server.On("students.v1", messagingtest.Stream(Student{ID: 1}, Student{ID: 2}).Delay(10*time.Millisecond)))
+	assert.NoError(t, server.On("student.v1.fail", messagingtest.Error(errors.New("boom"))))
+	assert.NoError(t, server.On("student.v1.slow", messagingtest.Value("late").Delay(300*time.Millisecond)))
+	assert.NoError(t, server.On("student.v1.noop", messagingtest.Empty()))
+
+	requester, err := server.Requester(context.Background(), messaging.Builder().DataMimeType("application/json"))
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	var student Student
+	err = requester.Route("student.v1.{id}", 1).
+		Metadata("foo", "text/plain").
+		Data(Student{Name: "bar"}).
+		RetrieveMono().
+		BlockTo(context.Background(), &student)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, Student{ID: 1, Name: "foo"}, student, "bad result")
+
+	var students []Student
+	err = requester.Route("students.v1").RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, []Student{{ID: 1}, {ID: 2}}, students, "bad result")
+
+	err = requester.Route("student.v1.fail").RetrieveMono().BlockTo(context.Background(), &student)
+	assert.Error(t, err, "should fail")
+	assert.Contains(t, err.Error(), "boom", "bad error")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var s string
+	err = requester.Route("student.v1.slow").RetrieveMono().BlockTo(ctx, &s)
+	assert.Error(t, err, "should be delayed")
+
+	err = requester.Route("not.exist").RetrieveMono().BlockTo(context.Background(), &s)
+	assert.Error(t, err, "should fail without script")
+
+	assert.NoError(t, requester.Route("student.v1.noop").Data(Student{ID: 3}).Retrieve())
+	requests, err := server.Wait(context.Background(), 6)
+	assert.NoError(t, err, "wait failed")
+
+	var routes []string
+	for _, it := range requests {
+		routes = append(routes, it.Route)
+	}
+	assert.Equal(t, []string{
+		"student.v1.1", "students.v1", "student.v1.fail", "student.v1.slow", "not.exist", "student.v1.noop",
+	}, routes, "bad requests")
+
+	first := requests[0]
+	assert.Equal(t, "application/json", first.DataMimeType, "bad data mime type")
+	var data Student
+	assert.NoError(t, first.BindData(&data))
+	assert.Equal(t, "bar", data.Name, "bad data")
+	var metadata string
+	assert.NoError(t, first.BindMetadata("text/plain", &metadata))
+	assert.Equal(t, "foo", metadata, "bad metadata")
+	assert.Error(t, first.BindMetadata("application/x-not-exist", &metadata))
+
+	assert.NoError(t, requests[5].BindData(&data))
+	assert.Equal(t, 3, data.ID, "bad data")
+
+	server.Reset()
+	assert.Empty(t, server.Requests(), "should be reset")
+}
@@ -0,0 +1,17 @@
+package messaging
+
+import "github.com/pkg/errors"
+
+// Recover is a middleware which converts a panic of the handler into an error.
+func Recover() Middleware {
+	return func(next RouteHandler) RouteHandler {
+		return func(c *RouteContext) (err error) {
+			defer func() {
+				if e := recover(); e != nil {
+					err = errors.Errorf("handle %s panic: %v", c.route, e)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
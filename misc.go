@@ -2,6 +2,25 @@ package messaging
 
 import "github.com/jjeffcaii/rsocket-messaging-go/internal"
 
+// MimeTypeProtobuf is the mime type of the protobuf codec, "application/vnd.google.protobuf" is also supported.
+const MimeTypeProtobuf = internal.MimeTypeProtobuf
+
+// MimeTypeMsgpack is the mime type of the MessagePack codec.
+const MimeTypeMsgpack = internal.MimeTypeMsgpack
+
+// CodecRegistry holds codecs by mime type, it's safe for concurrent use.
+type CodecRegistry = internal.CodecRegistry
+
+// NewCodecRegistry creates a codec registry which contains built-in codecs only.
+func NewCodecRegistry() *CodecRegistry {
+	return internal.NewCodecRegistry()
+}
+
+// DefaultCodecRegistry returns the global codec registry.
+func DefaultCodecRegistry() *CodecRegistry {
+	return internal.DefaultCodecRegistry
+}
+
 func RegisterCodec(mimeType string, marshal func(interface{}) ([]byte, error), unmarshal func([]byte, interface{}) error) error {
 	return internal.RegisterCodec(mimeType, marshal, unmarshal)
 }
@@ -0,0 +1,141 @@
+package messaging_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	rflux "github.com/jjeffcaii/reactor-go/flux"
+	"github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/rsocket/rsocket-go"
+	"github.com/rsocket/rsocket-go/extension"
+	"github.com/rsocket/rsocket-go/payload"
+	"github.com/rsocket/rsocket-go/rx"
+	"github.com/rsocket/rsocket-go/rx/flux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestChannel(t *testing.T) {
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{})
+	routes := make(chan string, 1)
+	go func() {
+		_ = rsocket.Receive().
+			OnStart(func() {
+				close(started)
+			}).
+			Acceptor(func(setup payload.SetupPayload, _ rsocket.CloseableRSocket) (rsocket.RSocket, error) {
+				return rsocket.NewAbstractSocket(rsocket.RequestChannel(func(msgs rx.Publisher) flux.Flux {
+					return flux.Clone(msgs).Map(func(input payload.Payload) payload.Payload {
+						if m, ok := input.Metadata(); ok {
+							scanner := extension.CompositeMetadata(m).Scanner()
+							for scanner.Scan() {
+								mimeType, raw, _ := scanner.Metadata()
+								if mimeType == extension.MessageRouting.String() {
+									tags, _ := extension.ParseRoutingTags(raw)
+									routes <- tags[0]
+								}
+							}
+						}
+						return payload.New(input.Data(), nil)
+					})
+				})), nil
+			}).
+			Transport(fmt.Sprintf("tcp://127.0.0.1:%d", port)).
+			Serve(ctx)
+	}()
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("start server timeout")
+	}
+
+	requester, err := messaging.Builder().ConnectTCP("127.0.0.1", port).Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	outbound := make(chan Student)
+	go func() {
+		defer close(outbound)
+		for i := 0; i < 3; i++ {
+			outbound <- Student{ID: i, Name: "foobar"}
+		}
+	}()
+	var students []Student
+	err = requester.Route("students.v1.echo").Data(outbound).RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request channel failed")
+	assert.Len(t, students, 3, "bad result")
+	assert.Equal(t, 2, students[2].ID, "bad result")
+	assert.Equal(t, "students.v1.echo", <-routes, "bad route")
+	assert.Len(t, routes, 0, "route should be sent once")
+
+	// complete lazily, the responder of rsocket-go may drop the first frame if COMPLETE arrives immediately.
+	publisher := flux.Create(func(ctx context.Context, sink flux.Sink) {
+		sink.Next(payload.NewString(`{"id":7}`, ""))
+		time.Sleep(50 * time.Millisecond)
+		sink.Complete()
+	})
+	err = requester.Route("students.v1.echo").
+		Data(publisher).
+		RetrieveFlux().
+		BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request channel failed")
+	assert.Equal(t, 7, students[3].ID, "bad result")
+	assert.Equal(t, "students.v1.echo", <-routes, "bad route")
+
+	// values of a reactor-go flux are encoded by the codec of requester, payloads are sent as they are.
+	values := rflux.Create(func(ctx context.Context, sink rflux.Sink) {
+		sink.Next(Student{ID: 8, Name: "foobar"})
+		sink.Next(payload.NewString(`{"id":9}`, ""))
+		time.Sleep(50 * time.Millisecond)
+		sink.Complete()
+	})
+	students = nil
+	err = requester.Route("students.v1.echo").Data(values).RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request channel failed")
+	assert.Equal(t, []Student{{ID: 8, Name: "foobar"}, {ID: 9}}, students, "bad result")
+	assert.Equal(t, "students.v1.echo", <-routes, "bad route")
+
+	err = requester.Route("students.v1.echo").Data(outbound).Retrieve()
+	assert.Error(t, err, "should fail")
+}
+
+func TestRequester_RouteTemplate(t *testing.T) {
+	router := messaging.NewRouter(messaging.Separator(messaging.SeparatorDot))
+	_ = router.Handle("students.{id}", func(id int) Student {
+		return Student{ID: id}
+	})
+	_ = router.Handle("users.{email}.profile", func(email string) string {
+		return email
+	})
+	loopback, stop := serve(t, router)
+	defer stop()
+
+	requester, err := messaging.Builder().ConnectLoopback(loopback).Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	var student Student
+	err = requester.Route("students.{id}", 42).RetrieveMono().BlockTo(context.Background(), &student)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, 42, student.ID, "bad result")
+	err = requester.Route("students.{id}", struct{ ID int }{7}).RetrieveMono().BlockTo(context.Background(), &student)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, 7, student.ID, "bad result")
+
+	var email string
+	err = requester.Route("users.{email}.profile", map[string]string{"email": "foo@bar.com"}).
+		RetrieveMono().
+		BlockTo(context.Background(), &email)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "foo@bar.com", email, "separators should be escaped")
+
+	err = requester.Route("students.%d").RetrieveMono().BlockTo(context.Background(), &student)
+	assert.Error(t, err, "unfilled verb should fail")
+	assert.Contains(t, err.Error(), "arguments don't match verbs", "bad error")
+	err = requester.Route("students.{id}").Retrieve()
+	assert.EqualError(t, err, "expand route students.{id} failed: require 1 values of variables, got 0")
+}
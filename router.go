@@ -1,21 +1,167 @@
 package messaging
 
 import (
-	"errors"
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
 
 	"github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/jjeffcaii/rsocket-messaging-go/spi"
+	"github.com/pkg/errors"
 )
 
-// TODO: responder-side router support
+var (
+	errRequireStream = errors.New("require a readable chan or a slice")
+	errMultiResponse = errors.New("response has been set already")
+)
 
 type RouteHandler = func(*RouteContext) error
 
+// Middleware wraps a RouteHandler, it can inspect the RouteContext before calling next or short-circuit with an error.
+type Middleware = func(next RouteHandler) RouteHandler
+
+// RouteSeparator decides which characters split a route into segments.
+type RouteSeparator string
+
+const (
+	SeparatorDot        RouteSeparator = "."
+	SeparatorSlash      RouteSeparator = "/"
+	SeparatorDotOrSlash RouteSeparator = internal.DefaultSeparators
+)
+
+// RouterOption configures a Router created by NewRouter.
+type RouterOption = func(*Router)
+
+// Separator sets the separator of routes, the default is SeparatorDotOrSlash.
+// A separator escaped by '\' is a part of segment, eg: "versions.1\.2" matches "versions.{v}" with v=1.2.
+func Separator(separator RouteSeparator) RouterOption {
+	return func(r *Router) {
+		if separator != "" {
+			r.table = newRouteTable(string(separator))
+		}
+	}
+}
+
+// EscapeSegment escapes the separators and '\' in a variable of route, so it's matched as a single segment.
+func EscapeSegment(segment string, separator RouteSeparator) string {
+	return internal.Escape(segment, string(separator))
+}
+
+// Router dispatches requests by route. Routes can be added, replaced and removed while it's serving requests, but
+// middlewares should be set up before.
 type Router struct {
-	routers *internal.PathTrie
+	table       *routeTable
+	parent      *Router
+	prefix      string
+	middlewares []Middleware
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Path string
+	// Handler is true if the route has a message handler.
+	Handler bool
+	// Connect is true if the route has a connect handler.
+	Connect bool
+}
+
+type route struct {
+	message *routeHandler
+	connect *routeHandler
+}
+
+// routeTable is shared by routers derived from the same one. Lookups read the current snapshot without locking, and
+// changes are applied to a copy which replaces the snapshot.
+type routeTable struct {
+	separators string
+	mu         sync.Mutex
+	snapshot   atomic.Value
+}
+
+// routeSnapshot holds routes and not-found handlers, the ones of groups are stored by prefix pattern.
+type routeSnapshot struct {
+	routes   *internal.PathTrie
+	fallback *routeHandler
+	prefixes *internal.PathTrie
+}
+
+func (t *routeTable) load() *routeSnapshot {
+	return t.snapshot.Load().(*routeSnapshot)
+}
+
+func (t *routeTable) update(fn func(s *routeSnapshot) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cur := t.load()
+	next := &routeSnapshot{
+		routes:   cur.routes.Clone(),
+		fallback: cur.fallback,
+		prefixes: cur.prefixes.Clone(),
+	}
+	if err := fn(next); err != nil {
+		return err
+	}
+	t.snapshot.Store(next)
+	return nil
+}
+
+func newRouteTable(separators string) *routeTable {
+	t := &routeTable{
+		separators: separators,
+	}
+	t.snapshot.Store(&routeSnapshot{
+		routes:   internal.NewPathTrieWithSeparators(separators),
+		prefixes: internal.NewPathTrieWithSeparators(separators),
+	})
+	return t
+}
+
+// routeHandler is a registered handler, the middlewares of its owner are resolved when it's invoked.
+type routeHandler struct {
+	fn          RouteHandler
+	owner       *Router
+	middlewares []Middleware
+}
+
+func (h *routeHandler) handle(c *RouteContext) error {
+	fn := h.fn
+	for i := len(h.middlewares) - 1; i >= 0; i-- {
+		fn = h.middlewares[i](fn)
+	}
+	for r := h.owner; r != nil; r = r.parent {
+		for i := len(r.middlewares) - 1; i >= 0; i-- {
+			fn = r.middlewares[i](fn)
+		}
+	}
+	return fn(c)
 }
 
 type RouteContext struct {
-	v *internal.PathVariables
+	ctx          context.Context
+	route        string
+	v            *internal.PathVariables
+	data         []byte
+	metadata     internal.MetadataEntries
+	dataMimeType string
+	resMimeType  string
+	codecs       *internal.CodecRegistry
+	principal    *Principal
+	response     interface{}
+	stream       *reflect.Value
+}
+
+// Context returns the context of current request.
+func (c *RouteContext) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Route returns the requested route.
+func (c *RouteContext) Route() string {
+	return c.route
 }
 
 func (c RouteContext) Variable(name string) (string, bool) {
@@ -30,26 +176,281 @@ func (c RouteContext) VariableOrCompute(name string, compute func() string) stri
 	return c.v.GetOrCompute(name, compute)
 }
 
-func (r *Router) Route(path string, handler RouteHandler) (err error) {
-	return r.routers.AddPath(path, handler)
+// Principal returns the authenticated principal of current request or connection, it's nil if anonymous.
+func (c *RouteContext) Principal() *Principal {
+	return c.principal
 }
 
-func (r *Router) Fire(path string) error {
-	v, h, ok := r.routers.Find(path)
+// Data returns the raw request data.
+func (c *RouteContext) Data() []byte {
+	return c.data
+}
+
+// DataMimeType returns the mime type of request data.
+func (c *RouteContext) DataMimeType() string {
+	return c.dataMimeType
+}
+
+// BindData decodes the request data into the target with the data mime type of current request.
+func (c *RouteContext) BindData(to interface{}) error {
+	return c.codecRegistry().Unmarshal(c.data, to, c.dataMimeType)
+}
+
+// Metadata returns the first metadata entry of given mime type.
+func (c *RouteContext) Metadata(mimeType string) ([]byte, bool) {
+	return c.metadata.Get(mimeType)
+}
+
+// MetadataEntries returns all metadata entries of current request by order, including the routing one.
+func (c *RouteContext) MetadataEntries() []spi.MetadataEntry {
+	return append([]spi.MetadataEntry(nil), c.metadata...)
+}
+
+// BindMetadata decodes the first metadata entry of given mime type into the target.
+func (c *RouteContext) BindMetadata(mimeType string, to interface{}) error {
+	raw, ok := c.metadata.Get(mimeType)
 	if !ok {
-		return errors.New("no router")
+		return errors.Errorf("no such metadata: %s", mimeType)
+	}
+	return c.codecRegistry().Unmarshal(raw, to, mimeType)
+}
+
+func (c *RouteContext) codecRegistry() *internal.CodecRegistry {
+	if c.codecs == nil {
+		return internal.DefaultCodecRegistry
+	}
+	return c.codecs
+}
+
+// Respond sets a single value as response, it will be encoded with the negotiated response mime type.
+func (c *RouteContext) Respond(v interface{}) error {
+	if c.response != nil || c.stream != nil {
+		return errMultiResponse
 	}
-	if h == nil {
-		return errors.New("no handler")
+	c.response = v
+	return nil
+}
+
+// RespondStream sets a readable chan or a slice as response of a stream request.
+// Values will be sent until the chan is closed.
+func (c *RouteContext) RespondStream(stream interface{}) error {
+	if c.response != nil || c.stream != nil {
+		return errMultiResponse
 	}
-	c := &RouteContext{
-		v: v,
+	value := reflect.ValueOf(stream)
+	switch value.Kind() {
+	case reflect.Chan:
+		if value.Type().ChanDir()&reflect.RecvDir == 0 {
+			return errRequireStream
+		}
+	case reflect.Slice, reflect.Array:
+	default:
+		return errRequireStream
+	}
+	c.stream = &value
+	return nil
+}
+
+// Use appends middlewares for all handlers of the router, including the ones registered before.
+// Middlewares of the parent router run first, then the ones of the router, and the ones of a route run last.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// With returns a router which shares routes with current router, handlers registered by it are wrapped by the
+// middlewares additionally.
+func (r *Router) With(middlewares ...Middleware) *Router {
+	return &Router{
+		table:       r.table,
+		parent:      r,
+		prefix:      r.prefix,
+		middlewares: middlewares,
 	}
-	return h.(RouteHandler)(c)
 }
 
-func NewRouter() *Router {
+// Group returns a sub router whose paths are registered under the prefix, eg: "student.v1". It has its own
+// middlewares and not-found fallback besides the ones of current router.
+func (r *Router) Group(prefix string) *Router {
 	return &Router{
-		routers: internal.NewPathTrie(),
+		table:  r.table,
+		parent: r,
+		prefix: r.path(prefix),
+	}
+}
+
+// Prefix returns the path prefix of the router.
+func (r *Router) Prefix() string {
+	return r.prefix
+}
+
+// NotFound sets the fallback handler for requests which have no handler and match the prefix of the router.
+// The fallback of the longest matched prefix wins.
+func (r *Router) NotFound(handler RouteHandler, middlewares ...Middleware) error {
+	h := r.newRouteHandler(handler, middlewares)
+	return r.table.update(func(s *routeSnapshot) error {
+		if r.prefix == "" {
+			s.fallback = h
+			return nil
+		}
+		return s.prefixes.ComputePath(r.prefix, func(interface{}, bool) (interface{}, error) {
+			return h, nil
+		})
+	})
+}
+
+func (r *Router) path(path string) string {
+	if r.prefix == "" {
+		return path
+	}
+	if path == "" {
+		return r.prefix
+	}
+	return r.prefix + r.table.separators[:1] + path
+}
+
+// Route registers a handler of the path, the middlewares only apply to this handler.
+// The path can contain {name} variables, {name:regex} constrained variables, "*" for any segment, and "**" or {*name}
+// at the end for the rest segments. The most specific pattern wins like spring: literal, then constrained variable,
+// then variable, then "*", then the catch-all ones.
+func (r *Router) Route(path string, handler RouteHandler, middlewares ...Middleware) (err error) {
+	h := r.newRouteHandler(handler, middlewares)
+	path = r.path(path)
+	return r.bind(path, func(rt *route) error {
+		if rt.message != nil {
+			return errors.Errorf("conflict path %s", path)
+		}
+		rt.message = h
+		return nil
+	})
+}
+
+// Replace registers a handler of the path like Route, but the existing handler is replaced instead of a conflict.
+func (r *Router) Replace(path string, handler RouteHandler, middlewares ...Middleware) error {
+	h := r.newRouteHandler(handler, middlewares)
+	return r.bind(r.path(path), func(rt *route) error {
+		rt.message = h
+		return nil
+	})
+}
+
+// Remove removes the handler and the connect handler of the path, which must be the same as the registered one.
+func (r *Router) Remove(path string) error {
+	path = r.path(path)
+	return r.table.update(func(s *routeSnapshot) error {
+		if _, ok := s.routes.RemovePath(path); !ok {
+			return errors.Errorf("no router for %s", path)
+		}
+		return nil
+	})
+}
+
+// Routes returns all routes of the router and the ones sharing routes with it, sorted by path.
+func (r *Router) Routes() (routes []RouteInfo) {
+	r.table.load().routes.Walk(func(pattern string, value interface{}) {
+		rt := value.(*route)
+		routes = append(routes, RouteInfo{
+			Path:    pattern,
+			Handler: rt.message != nil,
+			Connect: rt.connect != nil,
+		})
+	})
+	return
+}
+
+// Connect registers a handler for SETUP payloads routed to the path.
+// The setup data can be decoded by RouteContext.BindData, and returning an error rejects the connection with a
+// REJECTED_SETUP frame.
+func (r *Router) Connect(path string, handler RouteHandler, middlewares ...Middleware) (err error) {
+	h := r.newRouteHandler(handler, middlewares)
+	path = r.path(path)
+	return r.bind(path, func(rt *route) error {
+		if rt.connect != nil {
+			return errors.Errorf("conflict connect path %s", path)
+		}
+		rt.connect = h
+		return nil
+	})
+}
+
+func (r *Router) newRouteHandler(handler RouteHandler, middlewares []Middleware) *routeHandler {
+	return &routeHandler{
+		fn:          handler,
+		owner:       r,
+		middlewares: middlewares,
+	}
+}
+
+func (r *Router) bind(path string, fn func(*route) error) error {
+	return r.table.update(func(s *routeSnapshot) error {
+		return s.routes.ComputePath(path, func(old interface{}, exist bool) (interface{}, error) {
+			rt := &route{}
+			if exist {
+				*rt = *old.(*route)
+			}
+			if err := fn(rt); err != nil {
+				return nil, err
+			}
+			return rt, nil
+		})
+	})
+}
+
+// Fire invokes the handler of the path under the prefix of the router.
+func (r *Router) Fire(path string) error {
+	return r.fire(&RouteContext{
+		route: r.path(path),
+	})
+}
+
+func (r *Router) fire(c *RouteContext) error {
+	rt, err := r.find(c)
+	if err == nil && rt.message != nil {
+		return rt.message.handle(c)
+	}
+	if fallback := r.fallback(c); fallback != nil {
+		return fallback.handle(c)
+	}
+	if err != nil {
+		return err
+	}
+	return errors.Errorf("no handler for %s", c.route)
+}
+
+// fallback returns the not-found handler of the longest prefix which matches the route.
+func (r *Router) fallback(c *RouteContext) *routeHandler {
+	s := r.table.load()
+	for prefix, ok := c.route, c.route != ""; ok; prefix, ok = s.prefixes.TrimSegment(prefix) {
+		if v, h, found := s.prefixes.Find(prefix); found && h != nil {
+			c.v = v
+			return h.(*routeHandler)
+		}
+	}
+	return s.fallback
+}
+
+func (r *Router) fireConnect(c *RouteContext) error {
+	rt, err := r.find(c)
+	if err != nil || rt.connect == nil {
+		return nil
+	}
+	return rt.connect.handle(c)
+}
+
+func (r *Router) find(c *RouteContext) (*route, error) {
+	v, h, ok := r.table.load().routes.Find(c.route)
+	if !ok || h == nil {
+		return nil, errors.Errorf("no router for %s", c.route)
+	}
+	c.v = v
+	return h.(*route), nil
+}
+
+func NewRouter(options ...RouterOption) *Router {
+	r := &Router{
+		table: newRouteTable(internal.DefaultSeparators),
+	}
+	for _, option := range options {
+		option(r)
 	}
+	return r
 }
@@ -1,7 +1,9 @@
 package messaging_test
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 
 	. "github.com/jjeffcaii/rsocket-messaging-go"
@@ -20,3 +22,220 @@ func TestRouter_Route(t *testing.T) {
 	err = router.Fire("students.2020")
 	assert.NoError(t, err, "fire failed")
 }
+
+func TestRouter_Use(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next RouteHandler) RouteHandler {
+			return func(c *RouteContext) error {
+				calls = append(calls, name+":"+c.Route())
+				return next(c)
+			}
+		}
+	}
+	deny := func(next RouteHandler) RouteHandler {
+		return func(c *RouteContext) error {
+			if id, _ := c.Variable("id"); id == "0" {
+				return errors.New("denied")
+			}
+			return next(c)
+		}
+	}
+
+	router := NewRouter()
+	admin := router.With(trace("admin"), deny)
+	err := router.Route("students.{id}", func(c *RouteContext) error {
+		calls = append(calls, "handler")
+		return nil
+	}, trace("route"))
+	assert.NoError(t, err, "bind route failed")
+	err = admin.Route("admin.{id}", func(c *RouteContext) error {
+		calls = append(calls, "admin handler")
+		return nil
+	})
+	assert.NoError(t, err, "bind route failed")
+	err = router.Route("panic", func(c *RouteContext) error {
+		panic("boom")
+	}, Recover())
+	assert.NoError(t, err, "bind route failed")
+	// applies to routes registered before
+	router.Use(trace("root"))
+
+	assert.NoError(t, router.Fire("students.1"), "fire failed")
+	assert.Equal(t, []string{"root:students.1", "route:students.1", "handler"}, calls, "bad order")
+
+	calls = nil
+	assert.NoError(t, router.Fire("admin.1"), "fire failed")
+	assert.Equal(t, []string{"root:admin.1", "admin:admin.1", "admin handler"}, calls, "bad order")
+
+	calls = nil
+	assert.EqualError(t, router.Fire("admin.0"), "denied", "should be short-circuited")
+	assert.Equal(t, []string{"root:admin.0", "admin:admin.0"}, calls, "handler should not run")
+
+	err = router.Fire("panic")
+	assert.Error(t, err, "should recover")
+	assert.Contains(t, err.Error(), "boom", "bad error")
+}
+
+func TestRouter_Group(t *testing.T) {
+	var calls []string
+	record := func(name string) RouteHandler {
+		return func(c *RouteContext) error {
+			calls = append(calls, name+":"+c.Route())
+			return nil
+		}
+	}
+	router := NewRouter()
+	student := router.Group("student.v1")
+	assert.Equal(t, "student.v1", student.Prefix(), "bad prefix")
+	student.Use(func(next RouteHandler) RouteHandler {
+		return func(c *RouteContext) error {
+			calls = append(calls, "student middleware")
+			return next(c)
+		}
+	})
+	assert.NoError(t, student.Route("upsert", record("upsert")))
+	assert.NoError(t, student.Route("noop.{txt}", record("noop")))
+	assert.NoError(t, student.Route("{id}", record("id")))
+	assert.NoError(t, student.Group("admin").Route("reset", record("reset")))
+	assert.NoError(t, student.NotFound(record("student fallback")))
+	assert.Error(t, router.Route("student.v1.upsert", record("upsert")), "should conflict with group route")
+
+	tenant := router.Group("tenants.{tenant}")
+	assert.NoError(t, tenant.Handle("students.{id}", func(tenant string, id int) {
+		calls = append(calls, fmt.Sprintf("%s/%d", tenant, id))
+	}))
+	assert.NoError(t, tenant.NotFound(func(c *RouteContext) error {
+		name, _ := c.Variable("tenant")
+		calls = append(calls, "tenant fallback:"+name)
+		return nil
+	}))
+	assert.NoError(t, router.Route("ping", record("ping")))
+
+	assert.Error(t, router.Fire("not.exist"), "should fail without root fallback")
+	assert.NoError(t, router.NotFound(record("root fallback")))
+
+	for _, it := range []string{
+		"student.v1.upsert",
+		"student.v1.noop.hello",
+		"student.v1.42",
+		"student.v1.admin.reset",
+		"student.v1.x.y",
+		"tenants.foo.students.1",
+		"tenants.foo.unknown",
+		"ping",
+		"not.exist",
+	} {
+		assert.NoError(t, router.Fire(it), "fire %s failed", it)
+	}
+	assert.NoError(t, student.Fire("upsert"), "fire failed")
+	assert.Equal(t, []string{
+		"student middleware", "upsert:student.v1.upsert",
+		"student middleware", "noop:student.v1.noop.hello",
+		"student middleware", "id:student.v1.42",
+		"student middleware", "reset:student.v1.admin.reset",
+		"student middleware", "student fallback:student.v1.x.y",
+		"foo/1",
+		"tenant fallback:foo",
+		"ping:ping",
+		"root fallback:not.exist",
+		"student middleware", "upsert:student.v1.upsert",
+	}, calls, "bad calls")
+}
+
+func TestRouter_Wildcard(t *testing.T) {
+	var calls []string
+	router := NewRouter()
+	assert.NoError(t, router.Route("files.{*path}", func(c *RouteContext) error {
+		path, _ := c.Variable("path")
+		calls = append(calls, "path:"+path)
+		return nil
+	}))
+	assert.NoError(t, router.Route("files.*.meta", func(c *RouteContext) error {
+		calls = append(calls, "meta:"+c.Route())
+		return nil
+	}))
+	assert.NoError(t, router.Route("files.readme.meta", func(c *RouteContext) error {
+		calls = append(calls, "readme")
+		return nil
+	}))
+	for _, it := range []string{"files.readme.meta", "files.a.meta", "files.a.b.meta"} {
+		assert.NoError(t, router.Fire(it), "fire %s failed", it)
+	}
+	assert.Equal(t, []string{"readme", "meta:files.a.meta", "path:a.b.meta"}, calls, "bad calls")
+}
+
+func TestRouter_Concurrent(t *testing.T) {
+	router := NewRouter()
+	student := router.Group("student")
+	ok := func(c *RouteContext) error {
+		return nil
+	}
+	assert.NoError(t, student.Route("{id}", ok))
+	assert.NoError(t, router.Connect("setup", ok))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				assert.NoError(t, router.Fire("student.1"), "lookups should not fail")
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("feature%d.{name}", i)
+			for j := 0; j < 50; j++ {
+				assert.NoError(t, router.Route(path, ok))
+				assert.NoError(t, router.Remove(path))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Error(t, router.Remove("not.exist"), "should fail")
+	assert.Error(t, student.Route("{id}", ok), "should conflict")
+	assert.Error(t, student.Route("{name}", ok), "should conflict")
+	assert.NoError(t, student.Replace("{id}", func(c *RouteContext) error {
+		return errors.New("replaced")
+	}))
+	assert.EqualError(t, router.Fire("student.1"), "replaced", "should be replaced")
+	assert.Equal(t, []RouteInfo{
+		{Path: "setup", Connect: true},
+		{Path: "student.{id}", Handler: true},
+	}, router.Routes(), "bad routes")
+
+	assert.NoError(t, student.Remove("{id}"))
+	assert.Error(t, router.Fire("student.1"), "should be removed")
+	// the name of removed variable is released
+	assert.NoError(t, student.Route("{name}", ok))
+	assert.NoError(t, router.Fire("student.1"))
+	assert.Len(t, router.Routes(), 2)
+}
+
+func TestRouter_Separator(t *testing.T) {
+	var calls []string
+	record := func(c *RouteContext) error {
+		v, _ := c.Variable("v")
+		calls = append(calls, c.Route()+"="+v)
+		return nil
+	}
+	router := NewRouter(Separator(SeparatorSlash))
+	api := router.Group("api")
+	assert.NoError(t, api.Route("versions/{v}", record))
+	assert.NoError(t, api.NotFound(record))
+	assert.NoError(t, router.Fire("api/versions/1.2"))
+	assert.NoError(t, router.Fire("api/versions.1"), "should fall back")
+
+	router = NewRouter(Separator(SeparatorDot))
+	assert.NoError(t, router.Route("users.{v}.profile", record))
+	assert.NoError(t, router.Fire("users."+EscapeSegment("foo@bar.com", SeparatorDot)+".profile"))
+	assert.Error(t, router.Fire("users/foo/profile"), "slash should not split")
+
+	assert.Equal(t, []string{
+		"api/versions/1.2=1.2",
+		"api/versions.1=",
+		"users.foo@bar\\.com.profile=foo@bar.com",
+	}, calls, "bad calls")
+}
@@ -0,0 +1,465 @@
+package messaging
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/pkg/errors"
+)
+
+// Well-known auth types of message/x.rsocket.authentication.v0.
+const (
+	AuthTypeSimple = internal.AuthTypeSimple
+	AuthTypeBearer = internal.AuthTypeBearer
+)
+
+var (
+	errUnauthenticated = errors.New("unauthenticated")
+	errAccessDenied    = errors.New("access denied")
+	errBadCredentials  = errors.New("bad credentials")
+)
+
+// Principal is the authenticated identity of a connection or a request.
+type Principal struct {
+	Name   string
+	Roles  []string
+	Claims map[string]interface{}
+}
+
+// HasRole returns true if the principal has the role.
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, it := range p.Roles {
+		if it == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies the payload of an auth type and returns the principal.
+type Authenticator interface {
+	Authenticate(ctx context.Context, payload []byte) (*Principal, error)
+}
+
+// AuthenticatorFunc is an adapter to use a func as Authenticator.
+type AuthenticatorFunc func(ctx context.Context, payload []byte) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, payload []byte) (*Principal, error) {
+	return f(ctx, payload)
+}
+
+// AuthorizeRule decides whether the request can be handled, the principal is nil if the request is anonymous.
+type AuthorizeRule = func(c *RouteContext) error
+
+// Authenticated requires an authenticated principal.
+func Authenticated() AuthorizeRule {
+	return func(c *RouteContext) error {
+		if c.principal == nil {
+			return errUnauthenticated
+		}
+		return nil
+	}
+}
+
+// HasAnyRole requires an authenticated principal with one of the roles.
+func HasAnyRole(roles ...string) AuthorizeRule {
+	return func(c *RouteContext) error {
+		if c.principal == nil {
+			return errUnauthenticated
+		}
+		for _, it := range roles {
+			if c.principal.HasRole(it) {
+				return nil
+			}
+		}
+		return errAccessDenied
+	}
+}
+
+// HasClaim requires an authenticated principal with the claim value, it also matches an element of an array claim.
+// Values are compared deeply, and numbers are compared by value whatever their types are, eg: 1 matches float64(1)
+// of a JSON claim.
+func HasClaim(name string, value interface{}) AuthorizeRule {
+	expect := normalizeClaim(value)
+	return func(c *RouteContext) error {
+		if c.principal == nil {
+			return errUnauthenticated
+		}
+		found, ok := c.principal.Claims[name]
+		if !ok {
+			return errAccessDenied
+		}
+		if reflect.DeepEqual(normalizeClaim(found), expect) {
+			return nil
+		}
+		if v := reflect.ValueOf(found); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			for i := 0; i < v.Len(); i++ {
+				if reflect.DeepEqual(normalizeClaim(v.Index(i).Interface()), expect) {
+					return nil
+				}
+			}
+		}
+		return errAccessDenied
+	}
+}
+
+// normalizeClaim converts numbers to float64 like the claims decoded from JSON, other values are kept.
+func normalizeClaim(value interface{}) interface{} {
+	if n, ok := value.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+		return value
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	default:
+		return value
+	}
+}
+
+// Security holds authenticators by auth type and authorization rules by route pattern.
+type Security struct {
+	authenticators map[string]Authenticator
+	mu             sync.RWMutex
+	patterns       []authorizePattern
+	// rules are tries of patterns by the separators of routers, so patterns split a route like the router serving it.
+	rules map[string]*internal.PathTrie
+}
+
+type authorizePattern struct {
+	pattern string
+	rules   []AuthorizeRule
+}
+
+// Authenticator registers an authenticator for the auth type, eg: AuthTypeSimple, AuthTypeBearer or a custom one.
+// It's safe to register authenticators while serving.
+func (s *Security) Authenticator(authType string, authenticator Authenticator) error {
+	if authenticator == nil {
+		return errors.New("authenticator is nil")
+	}
+	s.mu.Lock()
+	s.authenticators[authType] = authenticator
+	s.mu.Unlock()
+	return nil
+}
+
+// Authorize registers rules for the route pattern, all of them must pass before the handler runs.
+// Routes without matched pattern are permitted. Patterns are split by the separators of the router which is served
+// with the Security.
+func (s *Security) Authorize(pattern string, rules ...AuthorizeRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := make(map[string]*internal.PathTrie, len(s.rules))
+	for separators, trie := range s.rules {
+		trie = trie.Clone()
+		if err := addAuthorizePattern(trie, authorizePattern{pattern: pattern, rules: rules}); err != nil {
+			return err
+		}
+		next[separators] = trie
+	}
+	s.rules = next
+	s.patterns = append(s.patterns, authorizePattern{pattern: pattern, rules: rules})
+	return nil
+}
+
+func addAuthorizePattern(trie *internal.PathTrie, p authorizePattern) error {
+	return trie.ComputePath(p.pattern, func(old interface{}, exist bool) (interface{}, error) {
+		if exist {
+			return nil, errors.Errorf("conflict authorize pattern %s", p.pattern)
+		}
+		return p.rules, nil
+	})
+}
+
+// loadRules returns the trie of patterns split by the separators, it's built once it's required.
+func (s *Security) loadRules(separators string) (*internal.PathTrie, error) {
+	s.mu.RLock()
+	trie, ok := s.rules[separators]
+	s.mu.RUnlock()
+	if ok {
+		return trie, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if trie, ok = s.rules[separators]; ok {
+		return trie, nil
+	}
+	trie = internal.NewPathTrieWithSeparators(separators)
+	for _, it := range s.patterns {
+		if err := addAuthorizePattern(trie, it); err != nil {
+			return nil, err
+		}
+	}
+	s.rules[separators] = trie
+	return trie, nil
+}
+
+// authenticate returns the principal of the auth metadata, or nil if there's no auth metadata. Malformed auth metadata
+// fails, so the frame is rejected instead of being handled as anonymous or by the principal of connection.
+func (s *Security) authenticate(ctx context.Context, entries internal.MetadataEntries) (*Principal, error) {
+	authType, payload, ok, err := entries.Auth()
+	if err != nil {
+		return nil, errors.Wrap(err, "bad auth metadata")
+	}
+	if !ok {
+		return nil, nil
+	}
+	s.mu.RLock()
+	authenticator, ok := s.authenticators[authType]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unsupported auth type: %s", authType)
+	}
+	principal, err := authenticator.Authenticate(ctx, payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "authenticate failed")
+	}
+	if principal == nil {
+		return nil, errUnauthenticated
+	}
+	return principal, nil
+}
+
+// authorize checks the rules of the route, which is split by the separators of the router.
+func (s *Security) authorize(c *RouteContext, separators string) error {
+	rules, err := s.loadRules(separators)
+	if err != nil {
+		return errors.Wrapf(err, "authorize %s failed", c.route)
+	}
+	v, found, ok := rules.Find(c.route)
+	if !ok || found == nil {
+		return nil
+	}
+	c.v = v
+	for _, rule := range found.([]AuthorizeRule) {
+		if err := rule(c); err != nil {
+			return errors.Wrapf(err, "authorize %s failed", c.route)
+		}
+	}
+	return nil
+}
+
+// NewSecurity creates an empty security config.
+func NewSecurity() *Security {
+	return &Security{
+		authenticators: make(map[string]Authenticator),
+		rules: map[string]*internal.PathTrie{
+			internal.DefaultSeparators: internal.NewPathTrie(),
+		},
+	}
+}
+
+// User is a user of simple authentication.
+type User struct {
+	Username string
+	Password string
+	Roles    []string
+}
+
+// UserStore loads users for simple authentication.
+type UserStore interface {
+	LoadUser(ctx context.Context, username string) (*User, error)
+}
+
+// MemoryUserStore is a UserStore which keeps users in memory, it's safe for concurrent use.
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+// Add adds or replaces a user.
+func (m *MemoryUserStore) Add(user User) {
+	m.mu.Lock()
+	m.users[user.Username] = user
+	m.mu.Unlock()
+}
+
+func (m *MemoryUserStore) LoadUser(_ context.Context, username string) (*User, error) {
+	m.mu.RLock()
+	user, ok := m.users[username]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// NewMemoryUserStore creates a MemoryUserStore with users.
+func NewMemoryUserStore(users ...User) *MemoryUserStore {
+	m := &MemoryUserStore{
+		users: make(map[string]User),
+	}
+	for _, it := range users {
+		m.Add(it)
+	}
+	return m
+}
+
+// SimpleAuthenticator verifies simple auth against a UserStore.
+type SimpleAuthenticator struct {
+	store UserStore
+	match func(raw, stored string) bool
+}
+
+// PasswordMatcher sets the func to verify passwords, eg: compare with a bcrypt hash. The default is plain comparison.
+func (a *SimpleAuthenticator) PasswordMatcher(match func(raw, stored string) bool) *SimpleAuthenticator {
+	a.match = match
+	return a
+}
+
+func (a *SimpleAuthenticator) Authenticate(ctx context.Context, payload []byte) (*Principal, error) {
+	username, password, err := internal.DecodeSimpleAuth(payload)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.store.LoadUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !a.match(password, user.Password) {
+		return nil, errBadCredentials
+	}
+	return &Principal{
+		Name:  user.Username,
+		Roles: user.Roles,
+	}, nil
+}
+
+// NewSimpleAuthenticator creates a SimpleAuthenticator with the user store.
+func NewSimpleAuthenticator(store UserStore) *SimpleAuthenticator {
+	return &SimpleAuthenticator{
+		store: store,
+		match: func(raw, stored string) bool {
+			return subtle.ConstantTimeCompare([]byte(raw), []byte(stored)) == 1
+		},
+	}
+}
+
+// JWTAuthenticator verifies bearer tokens as JWT with locally configured keys.
+// The subject becomes the principal name, and the roles are read from the "roles" claim by default.
+type JWTAuthenticator struct {
+	key        interface{}
+	keys       map[string]interface{}
+	issuer     string
+	audience   string
+	rolesClaim string
+}
+
+// Key sets the verification key for tokens without matched key id.
+// It can be []byte for HMAC, *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+func (a *JWTAuthenticator) Key(key interface{}) *JWTAuthenticator {
+	a.key = key
+	return a
+}
+
+// KeyID sets the verification key for tokens with the "kid" header.
+func (a *JWTAuthenticator) KeyID(kid string, key interface{}) *JWTAuthenticator {
+	a.keys[kid] = key
+	return a
+}
+
+// Issuer requires the "iss" claim.
+func (a *JWTAuthenticator) Issuer(issuer string) *JWTAuthenticator {
+	a.issuer = issuer
+	return a
+}
+
+// Audience requires the "aud" claim.
+func (a *JWTAuthenticator) Audience(audience string) *JWTAuthenticator {
+	a.audience = audience
+	return a
+}
+
+// RolesClaim sets the claim of roles, the value can be an array or a space separated string like "scope".
+func (a *JWTAuthenticator) RolesClaim(name string) *JWTAuthenticator {
+	a.rolesClaim = name
+	return a
+}
+
+func (a *JWTAuthenticator) Authenticate(_ context.Context, payload []byte) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(string(payload), claims, a.lookupKey); err != nil {
+		return nil, errors.Wrap(err, "invalid token")
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, errors.New("invalid token: bad issuer")
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return nil, errors.New("invalid token: bad audience")
+	}
+	principal := &Principal{
+		Claims: claims,
+	}
+	principal.Name, _ = claims["sub"].(string)
+	switch roles := claims[a.rolesClaim].(type) {
+	case string:
+		principal.Roles = strings.Fields(roles)
+	case []interface{}:
+		for _, it := range roles {
+			if role, ok := it.(string); ok {
+				principal.Roles = append(principal.Roles, role)
+			}
+		}
+	}
+	return principal, nil
+}
+
+func (a *JWTAuthenticator) lookupKey(token *jwt.Token) (interface{}, error) {
+	key := a.key
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if found, ok := a.keys[kid]; ok {
+			key = found
+		}
+	}
+	// the algorithm must match the key, otherwise a public key could be used as a HMAC secret.
+	var ok bool
+	switch key.(type) {
+	case []byte:
+		_, ok = token.Method.(*jwt.SigningMethodHMAC)
+	case *rsa.PublicKey:
+		_, ok = token.Method.(*jwt.SigningMethodRSA)
+		if !ok {
+			_, ok = token.Method.(*jwt.SigningMethodRSAPSS)
+		}
+	case *ecdsa.PublicKey:
+		_, ok = token.Method.(*jwt.SigningMethodECDSA)
+	case ed25519.PublicKey:
+		_, ok = token.Method.(*jwt.SigningMethodEd25519)
+	case nil:
+		return nil, errors.New("no key")
+	default:
+		return nil, errors.Errorf("unsupported key type %T", key)
+	}
+	if !ok {
+		return nil, errors.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key, nil
+}
+
+// NewJWTAuthenticator creates a JWTAuthenticator with the default verification key.
+func NewJWTAuthenticator(key interface{}) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		key:        key,
+		keys:       make(map[string]interface{}),
+		rolesClaim: "roles",
+	}
+}
@@ -0,0 +1,315 @@
+package messaging_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTAuthenticator(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err, "generate key failed")
+	authenticator := messaging.NewJWTAuthenticator([]byte("secret")).
+		KeyID("rsa", &key.PublicKey).
+		Issuer("tester").
+		RolesClaim("scope")
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) []byte {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		assert.NoError(t, err, "sign failed")
+		return []byte(s)
+	}
+
+	principal, err := authenticator.Authenticate(context.Background(), sign(jwt.SigningMethodRS256, "rsa", key, jwt.MapClaims{
+		"sub":   "foo",
+		"iss":   "tester",
+		"scope": "read write",
+	}))
+	assert.NoError(t, err, "authenticate failed")
+	assert.Equal(t, "foo", principal.Name, "bad name")
+	assert.Equal(t, []string{"read", "write"}, principal.Roles, "bad roles")
+
+	principal, err = authenticator.Authenticate(context.Background(), sign(jwt.SigningMethodHS256, "", []byte("secret"), jwt.MapClaims{
+		"sub": "bar",
+		"iss": "tester",
+	}))
+	assert.NoError(t, err, "authenticate failed")
+	assert.Equal(t, "bar", principal.Name, "bad name")
+
+	_, err = authenticator.Authenticate(context.Background(), sign(jwt.SigningMethodHS256, "", []byte("secret"), jwt.MapClaims{
+		"iss": "tester",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	}))
+	assert.Error(t, err, "expired token should fail")
+	_, err = authenticator.Authenticate(context.Background(), sign(jwt.SigningMethodHS256, "", []byte("secret"), jwt.MapClaims{
+		"iss": "other",
+	}))
+	assert.Error(t, err, "bad issuer should fail")
+	_, err = authenticator.Authenticate(context.Background(), sign(jwt.SigningMethodHS256, "rsa", []byte("secret"), jwt.MapClaims{
+		"iss": "tester",
+	}))
+	assert.Error(t, err, "mismatched signing method should fail")
+	_, err = authenticator.Authenticate(context.Background(), []byte("not a token"))
+	assert.Error(t, err, "should fail")
+}
+
+func TestServer_Security(t *testing.T) {
+	secret := []byte("secret")
+	security := messaging.NewSecurity()
+	users := messaging.NewMemoryUserStore(messaging.User{Username: "admin", Password: "admin", Roles: []string{"ADMIN"}})
+	assert.NoError(t, security.Authenticator(messaging.AuthTypeSimple, messaging.NewSimpleAuthenticator(users)))
+	assert.NoError(t, security.Authenticator(messaging.AuthTypeBearer, messaging.NewJWTAuthenticator(secret)))
+	assert.NoError(t, security.Authorize("students.v1.{id}.delete", messaging.HasAnyRole("ADMIN")))
+	assert.NoError(t, security.Authorize("students.v1.{id}", messaging.Authenticated()))
+	assert.NoError(t, security.Authorize("tenants.{tenant}", messaging.HasClaim("tenants", "foo")))
+	assert.Error(t, security.Authorize("students.v1.{id}", messaging.Authenticated()), "should conflict")
+
+	var deleted int32
+	router := messaging.NewRouter()
+	_ = router.Route("students.v1.{id}.delete", func(c *messaging.RouteContext) error {
+		atomic.AddInt32(&deleted, 1)
+		return c.Respond(c.Principal().Name)
+	})
+	_ = router.Route("students.v1.{id}", func(c *messaging.RouteContext) error {
+		return c.Respond(c.Principal().Name)
+	})
+	_ = router.Route("tenants.{tenant}", func(c *messaging.RouteContext) error {
+		tenant, _ := c.Variable("tenant")
+		return c.Respond(tenant)
+	})
+	_ = router.Route("public", func(c *messaging.RouteContext) error {
+		return c.Respond(c.Principal() == nil)
+	})
+
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{})
+	go func() {
+		_ = messaging.Server().
+			Router(router).
+			Security(security).
+			ListenTCP("127.0.0.1", port).
+			OnStart(func() {
+				close(started)
+			}).
+			Serve(ctx)
+	}()
+	<-started
+
+	token := func(claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		assert.NoError(t, err, "sign failed")
+		return s
+	}
+
+	anonymous, err := messaging.Builder().ConnectTCP("127.0.0.1", port).Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer anonymous.Close()
+
+	var anon bool
+	err = anonymous.Route("public").RetrieveMono().BlockTo(context.Background(), &anon)
+	assert.NoError(t, err, "request failed")
+	assert.True(t, anon, "should be anonymous")
+
+	var name string
+	err = anonymous.Route("students.v1.1").RetrieveMono().BlockTo(context.Background(), &name)
+	assert.Error(t, err, "should be unauthenticated")
+	assert.Contains(t, err.Error(), "APPLICATION_ERROR", "bad error")
+
+	err = anonymous.Route("students.v1.1").
+		AuthBearer(token(jwt.MapClaims{"sub": "foo"})).
+		RetrieveMono().
+		BlockTo(context.Background(), &name)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "foo", name, "bad principal")
+
+	err = anonymous.Route("students.v1.1.delete").
+		AuthBearer(token(jwt.MapClaims{"sub": "foo"})).
+		RetrieveMono().
+		BlockTo(context.Background(), &name)
+	assert.Error(t, err, "should be denied")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&deleted), "handler should not run")
+
+	err = anonymous.Route("students.v1.1").AuthBearer("bad token").RetrieveMono().BlockTo(context.Background(), &name)
+	assert.Error(t, err, "should fail")
+
+	err = anonymous.Route("tenants.foo").
+		AuthBearer(token(jwt.MapClaims{"sub": "foo", "tenants": []string{"bar", "foo"}})).
+		RetrieveMono().
+		BlockTo(context.Background(), &name)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "foo", name, "bad result")
+
+	admin, err := messaging.Builder().
+		SetupAuthSimple("admin", "admin").
+		ConnectTCP("127.0.0.1", port).
+		Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer admin.Close()
+	err = admin.Route("students.v1.1.delete").RetrieveMono().BlockTo(context.Background(), &name)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "admin", name, "bad principal")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&deleted), "handler should run")
+
+	// malformed auth metadata must not fall back to the principal of connection
+	err = admin.Route("students.v1.1.delete").
+		Metadata([]byte{0x05}, "message/x.rsocket.authentication.v0").
+		RetrieveMono().
+		BlockTo(context.Background(), &name)
+	if assert.Error(t, err, "malformed auth should be rejected") {
+		assert.Contains(t, err.Error(), "APPLICATION_ERROR", "bad error")
+		assert.Contains(t, err.Error(), "bad auth metadata", "bad error")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&deleted), "handler should not run")
+
+	expectRejected(t, messaging.Builder().SetupAuthSimple("admin", "bad"), port, "bad credentials")
+	expectRejected(t, messaging.Builder().SetupMetadata([]byte{0x05}, "message/x.rsocket.authentication.v0"), port, "bad auth metadata")
+}
+
+func expectRejected(t *testing.T, builder *messaging.RequestBuilder, port int, reason string) {
+	closed := make(chan error, 1)
+	rejected, err := builder.
+		OnClose(func(err error) {
+			closed <- err
+		}).
+		ConnectTCP("127.0.0.1", port).
+		Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer rejected.Close()
+	select {
+	case err = <-closed:
+		if assert.Error(t, err, "should be rejected") {
+			assert.Contains(t, err.Error(), "REJECTED_SETUP", "should be rejected")
+			assert.Contains(t, err.Error(), reason, "bad reject reason")
+		}
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "reject timeout")
+	}
+}
+
+func TestServer_SecuritySeparator(t *testing.T) {
+	security := messaging.NewSecurity()
+	assert.NoError(t, security.Authorize("admin/{v}", messaging.Authenticated()))
+	router := messaging.NewRouter(messaging.Separator(messaging.SeparatorSlash))
+	assert.NoError(t, router.Handle("admin/{v}", func(v string) string {
+		return v
+	}))
+	loopback, err := messaging.Server().Router(router).Security(security).ServeLoopback(context.Background())
+	assert.NoError(t, err, "serve failed")
+	defer loopback.Close()
+
+	requester, err := messaging.Builder().ConnectLoopback(loopback).Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	var v string
+	err = requester.Route("admin/1.2").RetrieveMono().BlockTo(context.Background(), &v)
+	assert.Error(t, err, "should be split by the separator of router")
+	assert.Contains(t, err.Error(), "unauthenticated", "bad error")
+}
+
+func TestHasClaim(t *testing.T) {
+	security := messaging.NewSecurity()
+	// claims are decoded from the JSON token, so numbers are float64
+	assert.NoError(t, security.Authenticator(messaging.AuthTypeBearer, messaging.AuthenticatorFunc(
+		func(_ context.Context, payload []byte) (*messaging.Principal, error) {
+			principal := &messaging.Principal{Name: "foo"}
+			if err := json.Unmarshal(payload, &principal.Claims); err != nil {
+				return nil, err
+			}
+			return principal, nil
+		})))
+	assert.NoError(t, security.Authorize("level", messaging.HasClaim("level", 3)))
+	assert.NoError(t, security.Authorize("groups", messaging.HasClaim("groups", uint8(2))))
+	assert.NoError(t, security.Authorize("address", messaging.HasClaim("address", map[string]interface{}{"city": "bar"})))
+	assert.NoError(t, security.Authorize("scopes", messaging.HasClaim("scopes", []interface{}{"read", "write"})))
+	router := messaging.NewRouter()
+	for _, it := range []string{"level", "groups", "address", "scopes"} {
+		assert.NoError(t, router.Handle(it, func() string {
+			return "ok"
+		}))
+	}
+	loopback, err := messaging.Server().Router(router).Security(security).ServeLoopback(context.Background())
+	assert.NoError(t, err, "serve failed")
+	defer loopback.Close()
+	requester, err := messaging.Builder().ConnectLoopback(loopback).Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	for _, it := range []struct {
+		route  string
+		claims string
+		ok     bool
+	}{
+		{"level", `{"level":3}`, true},
+		{"level", `{"level":3.5}`, false},
+		{"level", `{"level":"3"}`, false},
+		{"level", `{}`, false},
+		{"groups", `{"groups":[1,2]}`, true},
+		{"groups", `{"groups":[1,3]}`, false},
+		{"address", `{"address":{"city":"bar"}}`, true},
+		{"address", `{"address":{"city":"foo"}}`, false},
+		{"address", `{"address":[{"city":"foo"},{"city":"bar"}]}`, true},
+		{"scopes", `{"scopes":["read","write"]}`, true},
+		{"scopes", `{"scopes":["read"]}`, false},
+	} {
+		var res string
+		err := requester.Route(it.route).AuthBearer(it.claims).RetrieveMono().BlockTo(context.Background(), &res)
+		if it.ok {
+			assert.NoError(t, err, "%s should be authorized with %s", it.route, it.claims)
+		} else {
+			assert.Error(t, err, "%s should be denied with %s", it.route, it.claims)
+		}
+	}
+}
+
+func TestSecurity_ConcurrentAuthenticator(t *testing.T) {
+	security := messaging.NewSecurity()
+	router := messaging.NewRouter()
+	assert.NoError(t, router.Handle("whoami", func(c *messaging.RouteContext) string {
+		return c.Principal().Name
+	}))
+	loopback, err := messaging.Server().Router(router).Security(security).ServeLoopback(context.Background())
+	assert.NoError(t, err, "serve failed")
+	defer loopback.Close()
+	requester, err := messaging.Builder().ConnectLoopback(loopback).Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = security.Authenticator(fmt.Sprintf("x-custom-%d", i), messaging.AuthenticatorFunc(
+				func(context.Context, []byte) (*messaging.Principal, error) {
+					return nil, errors.New("bad credentials")
+				}))
+		}
+	}()
+	assert.NoError(t, security.Authenticator(messaging.AuthTypeBearer, messaging.AuthenticatorFunc(
+		func(_ context.Context, payload []byte) (*messaging.Principal, error) {
+			return &messaging.Principal{Name: string(payload)}, nil
+		})))
+	for i := 0; i < 20; i++ {
+		var name string
+		err := requester.Route("whoami").AuthBearer("foo").RetrieveMono().BlockTo(context.Background(), &name)
+		assert.NoError(t, err, "request failed")
+		assert.Equal(t, "foo", name, "bad principal")
+	}
+	<-done
+}
@@ -0,0 +1,258 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/pkg/errors"
+	"github.com/rsocket/rsocket-go"
+	"github.com/rsocket/rsocket-go/logger"
+	"github.com/rsocket/rsocket-go/payload"
+	"github.com/rsocket/rsocket-go/rx/flux"
+	"github.com/rsocket/rsocket-go/rx/mono"
+)
+
+var errNoRouter = errors.New("no router")
+
+type ServerBuilder struct {
+	router   *Router
+	tpUrl    string
+	onStart  []func()
+	codecs   *internal.CodecRegistry
+	security *Security
+}
+
+func (b *ServerBuilder) Router(router *Router) *ServerBuilder {
+	b.router = router
+	return b
+}
+
+func (b *ServerBuilder) ListenTCP(host string, port int) *ServerBuilder {
+	b.tpUrl = fmt.Sprintf("tcp://%s:%d", host, port)
+	return b
+}
+
+// CodecRegistry sets the codecs used by the responder instead of the default registry.
+func (b *ServerBuilder) CodecRegistry(codecs *CodecRegistry) *ServerBuilder {
+	b.codecs = codecs
+	return b
+}
+
+// Security sets the authenticators and authorization rules, auth metadata in SETUP frames authenticates the whole
+// connection and auth metadata in request frames overrides it.
+func (b *ServerBuilder) Security(security *Security) *ServerBuilder {
+	b.security = security
+	return b
+}
+
+func (b *ServerBuilder) OnStart(onStart func()) *ServerBuilder {
+	b.onStart = append(b.onStart, onStart)
+	return b
+}
+
+func (b *ServerBuilder) Serve(ctx context.Context) error {
+	if b.router == nil {
+		return errNoRouter
+	}
+	sb := rsocket.Receive()
+	for _, it := range b.onStart {
+		sb = sb.OnStart(it)
+	}
+	return sb.
+		Acceptor(func(setup payload.SetupPayload, _ rsocket.CloseableRSocket) (rsocket.RSocket, error) {
+			responder := newResponder(b.router, b.codecs, b.security, setup)
+			if err := responder.connect(setup); err != nil {
+				return nil, err
+			}
+			return responder.socket(), nil
+		}).
+		Transport(b.tpUrl).
+		Serve(ctx)
+}
+
+func Server() *ServerBuilder {
+	return &ServerBuilder{
+		codecs: internal.DefaultCodecRegistry,
+	}
+}
+
+type responder struct {
+	router           *Router
+	codecs           *internal.CodecRegistry
+	security         *Security
+	principal        *Principal
+	dataMimeType     string
+	metadataMimeType string
+}
+
+func (p *responder) socket() rsocket.RSocket {
+	return rsocket.NewAbstractSocket(
+		rsocket.FireAndForget(p.fireAndForget),
+		rsocket.RequestResponse(p.requestResponse),
+		rsocket.RequestStream(p.requestStream),
+	)
+}
+
+func (p *responder) connect(setup payload.SetupPayload) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.Errorf("handle setup failed: %v", e)
+		}
+	}()
+	raw, _ := setup.Metadata()
+	entries, err := internal.ParseMetadata(raw, p.metadataMimeType)
+	if err != nil {
+		return
+	}
+	if p.security != nil {
+		if p.principal, err = p.security.authenticate(context.Background(), entries); err != nil {
+			return
+		}
+	}
+	route, err := entries.Route()
+	if err != nil {
+		// no routing metadata in setup
+		return nil
+	}
+	return p.router.fireConnect(&RouteContext{
+		ctx:          context.Background(),
+		route:        route,
+		data:         setup.Data(),
+		metadata:     entries,
+		dataMimeType: p.dataMimeType,
+		codecs:       p.codecs,
+		principal:    p.principal,
+	})
+}
+
+func (p *responder) fireAndForget(msg payload.Payload) {
+	go func() {
+		// the handler runs out of the recover of rsocket-go, so a panic must not crash the whole server.
+		defer func() {
+			if e := recover(); e != nil {
+				logger.Errorf("handle fire-and-forget failed: %v\n", e)
+			}
+		}()
+		c, err := p.newRouteContext(context.Background(), msg)
+		if err == nil {
+			err = p.router.fire(c)
+		}
+		if err != nil {
+			logger.Warnf("handle fire-and-forget failed: %s\n", err)
+		}
+	}()
+}
+
+func (p *responder) requestResponse(msg payload.Payload) mono.Mono {
+	return mono.Create(func(ctx context.Context, sink mono.Sink) {
+		c, err := p.newRouteContext(ctx, msg)
+		if err == nil {
+			err = p.router.fire(c)
+		}
+		if err != nil {
+			sink.Error(err)
+			return
+		}
+		if c.stream != nil {
+			sink.Error(errors.Errorf("cannot respond a stream for request-response: %s", c.route))
+			return
+		}
+		if c.response == nil {
+			sink.Success(nil)
+			return
+		}
+		res, err := p.encode(c, c.response)
+		if err != nil {
+			sink.Error(err)
+			return
+		}
+		sink.Success(res)
+	})
+}
+
+// requestStream calls the handler once the stream is subscribed, and its context is canceled when the stream finishes.
+func (p *responder) requestStream(msg payload.Payload) flux.Flux {
+	return internal.NewFluxWithEmitter(func(ctx context.Context, sink flux.Sink) error {
+		c, err := p.newRouteContext(ctx, msg)
+		if err == nil {
+			err = p.router.fire(c)
+		}
+		if err != nil {
+			return err
+		}
+		return p.emit(ctx, c, sink)
+	})
+}
+
+func (p *responder) emit(ctx context.Context, c *RouteContext, sink flux.Sink) error {
+	encode := func(v interface{}) (payload.Payload, error) {
+		return p.encode(c, v)
+	}
+	if c.response != nil {
+		next, err := encode(c.response)
+		if err != nil {
+			return err
+		}
+		sink.Next(next)
+	}
+	if c.stream == nil {
+		return nil
+	}
+	return internal.EmitValues(ctx, sink, *c.stream, encode)
+}
+
+func (p *responder) newRouteContext(ctx context.Context, msg payload.Payload) (c *RouteContext, err error) {
+	raw, _ := msg.Metadata()
+	entries, err := internal.ParseMetadata(raw, p.metadataMimeType)
+	if err != nil {
+		return
+	}
+	route, err := entries.Route()
+	if err != nil {
+		return
+	}
+	dataMimeType := p.dataMimeType
+	if found, ok := entries.MimeType(); ok {
+		dataMimeType = found
+	}
+	c = &RouteContext{
+		ctx:          ctx,
+		route:        route,
+		data:         msg.Data(),
+		metadata:     entries,
+		dataMimeType: dataMimeType,
+		resMimeType:  p.codecs.Negotiate(dataMimeType, entries.AcceptMimeTypes()),
+		codecs:       p.codecs,
+		principal:    p.principal,
+	}
+	if p.security == nil {
+		return
+	}
+	principal, err := p.security.authenticate(ctx, entries)
+	if err != nil {
+		return
+	}
+	if principal != nil {
+		c.principal = principal
+	}
+	err = p.security.authorize(c, p.router.table.separators)
+	return
+}
+
+func (p *responder) encode(c *RouteContext, v interface{}) (payload.Payload, error) {
+	return p.codecs.EncodeResponse(v, c.resMimeType, p.dataMimeType, p.metadataMimeType)
+}
+
+func newResponder(router *Router, codecs *internal.CodecRegistry, security *Security, setup payload.SetupPayload) *responder {
+	if codecs == nil {
+		codecs = internal.DefaultCodecRegistry
+	}
+	return &responder{
+		router:           router,
+		codecs:           codecs,
+		security:         security,
+		dataMimeType:     setup.DataMimeType(),
+		metadataMimeType: setup.MetadataMimeType(),
+	}
+}
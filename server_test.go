@@ -0,0 +1,449 @@
+package messaging_test
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/jjeffcaii/rsocket-messaging-go/spi"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type Result struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func serve(t *testing.T, router *messaging.Router) (loopback *messaging.Loopback, stop func()) {
+	loopback, err := messaging.Server().
+		Router(router).
+		ServeLoopback(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loopback, func() {
+		_ = loopback.Close()
+	}
+}
+
+func startServer(t *testing.T, router *messaging.Router) (spi.Requester, func()) {
+	loopback, stop := serve(t, router)
+	requester, err := messaging.Builder().
+		ConnectLoopback(loopback).
+		Build(context.Background())
+	if err != nil {
+		stop()
+		t.Fatal(err)
+	}
+	return requester, func() {
+		_ = requester.Close()
+		stop()
+	}
+}
+
+func TestServer(t *testing.T) {
+	noop := make(chan string, 1)
+	router := messaging.NewRouter()
+	_ = router.Route("student.v1.upsert", func(c *messaging.RouteContext) (err error) {
+		var student Student
+		if err = c.BindData(&student); err != nil {
+			return
+		}
+		student.ID = 1234
+		return c.Respond(Result{Data: student})
+	})
+	_ = router.Route("student.v1.noop.{txt}", func(c *messaging.RouteContext) error {
+		txt, _ := c.Variable("txt")
+		noop <- txt
+		return nil
+	})
+	_ = router.Route("student.v1.{id}", func(c *messaging.RouteContext) error {
+		id, _ := c.Variable("id")
+		return c.Respond(Student{Name: "foobar", Birth: id})
+	})
+	_ = router.Route("students.v1", func(c *messaging.RouteContext) error {
+		students := make(chan Student)
+		go func() {
+			defer close(students)
+			for i := 0; i < 10; i++ {
+				students <- Student{ID: i, Name: "foobar"}
+			}
+		}()
+		return c.RespondStream(students)
+	})
+
+	requester, stop := startServer(t, router)
+	defer stop()
+
+	err := requester.Route("student.v1.noop.%s", "hello").Retrieve()
+	assert.NoError(t, err, "request failed")
+	select {
+	case txt := <-noop:
+		assert.Equal(t, "hello", txt, "bad variable")
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "fire-and-forget timeout")
+	}
+
+	var result Result
+	err = requester.Route("student.v1.upsert").
+		Data(Student{Name: "Foobar", Birth: "2020-04-28"}).
+		RetrieveMono().
+		BlockTo(context.Background(), &result)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, float64(1234), result.Data.(map[string]interface{})["id"], "bad result")
+
+	var student Student
+	err = requester.Route("student.v1.%d", 42).RetrieveMono().BlockTo(context.Background(), &student)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "42", student.Birth, "bad result")
+
+	var students []Student
+	err = requester.Route("students.v1").RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request failed")
+	assert.Len(t, students, 10, "bad result")
+
+	err = requester.Route("not.exist").RetrieveMono().BlockTo(context.Background(), &student)
+	assert.Error(t, err, "should fail")
+	err = requester.Route("not.exist").RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.Error(t, err, "should fail")
+}
+
+func TestServer_Panic(t *testing.T) {
+	done := make(chan struct{})
+	router := messaging.NewRouter()
+	_ = router.Route("student.v1.panic", func(c *messaging.RouteContext) error {
+		defer close(done)
+		var students map[string]Student
+		students["foobar"] = Student{}
+		return nil
+	})
+	_ = router.Route("students.v1.panic", func(c *messaging.RouteContext) error {
+		var students map[string]Student
+		students["foobar"] = Student{}
+		return nil
+	})
+	_ = router.Route("student.v1.{id}", func(c *messaging.RouteContext) error {
+		id, _ := c.Variable("id")
+		return c.Respond(Student{Birth: id})
+	})
+
+	requester, stop := startServer(t, router)
+	defer stop()
+
+	var students []Student
+	err := requester.Route("students.v1.panic").RetrieveFlux().BlockToSlice(context.Background(), &students)
+	assert.Error(t, err, "request-stream should fail")
+
+	assert.NoError(t, requester.Route("student.v1.panic").Retrieve(), "request failed")
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "fire-and-forget timeout")
+	}
+	var student Student
+	err = requester.Route("student.v1.{id}", 42).RetrieveMono().BlockTo(context.Background(), &student)
+	assert.NoError(t, err, "server should survive the panic")
+	assert.Equal(t, "42", student.Birth, "bad result")
+}
+
+func TestServer_Connect(t *testing.T) {
+	type token struct {
+		Value string `json:"value"`
+	}
+	router := messaging.NewRouter()
+	err := router.Connect("connect.{client}", func(c *messaging.RouteContext) (err error) {
+		var tk token
+		if err = c.BindData(&tk); err != nil {
+			return
+		}
+		client, _ := c.Variable("client")
+		var tenant string
+		_ = c.BindMetadata("text/plain", &tenant)
+		if tk.Value != "secret" || tenant != "foo" {
+			return errors.Errorf("client %s is rejected", client)
+		}
+		return
+	})
+	assert.NoError(t, err, "bind connect route failed")
+	err = router.Route("connect.{client}", func(c *messaging.RouteContext) error {
+		return c.Respond("pong")
+	})
+	assert.NoError(t, err, "bind route failed")
+	err = router.Connect("connect.{name}", func(c *messaging.RouteContext) error {
+		return nil
+	})
+	assert.Error(t, err, "should conflict")
+
+	loopback, stop := serve(t, router)
+	defer stop()
+
+	connect := func(secret string, onClose func(error)) spi.Requester {
+		requester, err := messaging.Builder().
+			SetupRoute("connect.%s", "tester").
+			SetupMetadata("foo", "text/plain").
+			SetupData(token{Value: secret}).
+			OnClose(onClose).
+			ConnectLoopback(loopback).
+			Build(context.Background())
+		assert.NoError(t, err, "connect failed")
+		return requester
+	}
+
+	requester := connect("secret", nil)
+	var pong string
+	err = requester.Route("connect.tester").RetrieveMono().BlockTo(context.Background(), &pong)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "pong", pong, "bad result")
+	_ = requester.Close()
+
+	closed := make(chan error, 1)
+	requester = connect("bad", func(err error) {
+		closed <- err
+	})
+	defer requester.Close()
+	select {
+	case err = <-closed:
+		assert.Error(t, err, "should be rejected")
+		assert.Contains(t, err.Error(), "REJECTED_SETUP", "should be rejected")
+		assert.Contains(t, err.Error(), "client tester is rejected", "bad reject reason")
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "reject timeout")
+	}
+}
+
+func TestServer_MimeTypes(t *testing.T) {
+	router := messaging.NewRouter()
+	_ = router.Handle("students.v1.name", func(c *messaging.RouteContext, s Student) string {
+		assert.Equal(t, "application/xml", c.DataMimeType(), "bad data mime type")
+		return s.Name
+	})
+	_ = router.Handle("students.v1.echo", func(s Student) Student {
+		return s
+	})
+	requester, stop := startServer(t, router)
+	defer stop()
+
+	var name string
+	err := requester.Route("students.v1.name").
+		DataMimeType("application/xml").
+		AcceptMimeTypes("text/plain").
+		Data(Student{Name: "foobar"}).
+		RetrieveMono().
+		BlockTo(context.Background(), &name)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "foobar", name, "bad result")
+
+	var students []Student
+	err = requester.Route("students.v1.echo").
+		AcceptMimeTypes("application/x-not-exist", "application/xml").
+		Data(Student{ID: 1, Name: "foobar"}).
+		RetrieveFlux().
+		BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, []Student{{ID: 1, Name: "foobar"}}, students, "bad result")
+
+	res, err := requester.Route("students.v1.echo").
+		AcceptMimeTypes("application/xml").
+		Data(Student{ID: 1}).
+		RetrieveMono().
+		Block(context.Background())
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "<Student><ID>1</ID><Name></Name><Birth></Birth></Student>", res.DataUTF8(), "bad result")
+}
+
+func TestServer_CodecRegistry(t *testing.T) {
+	const mimeType = "text/x-upper"
+	codecs := messaging.NewCodecRegistry()
+	err := codecs.Register(mimeType, func(v interface{}) ([]byte, error) {
+		return []byte(strings.ToUpper(v.(string))), nil
+	}, func(b []byte, v interface{}) error {
+		*(v.(*string)) = strings.ToLower(string(b))
+		return nil
+	})
+	assert.NoError(t, err, "register failed")
+
+	router := messaging.NewRouter()
+	_ = router.Handle("echo", func(c *messaging.RouteContext, s string) string {
+		assert.Equal(t, "foobar", s, "bad request")
+		return s
+	})
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{})
+	go func() {
+		_ = messaging.Server().
+			Router(router).
+			CodecRegistry(codecs).
+			ListenTCP("127.0.0.1", port).
+			OnStart(func() {
+				close(started)
+			}).
+			Serve(ctx)
+	}()
+	<-started
+
+	requester, err := messaging.Builder().
+		DataMimeType(mimeType).
+		CodecRegistry(codecs).
+		ConnectTCP("127.0.0.1", port).
+		Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	res, err := requester.Route("echo").Data("foobar").RetrieveMono().Block(context.Background())
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, "FOOBAR", res.DataUTF8(), "bad result")
+}
+
+func TestServer_Protobuf(t *testing.T) {
+	router := messaging.NewRouter()
+	_ = router.Handle("greetings.{n}", func(n int, name *wrapperspb.StringValue) chan *wrapperspb.StringValue {
+		res := make(chan *wrapperspb.StringValue, n)
+		for i := 0; i < n; i++ {
+			res <- wrapperspb.String("hello " + name.GetValue())
+		}
+		close(res)
+		return res
+	})
+	requester, stop := startServer(t, router)
+	defer stop()
+
+	var greetings []*wrapperspb.StringValue
+	err := requester.Route("greetings.%d", 3).
+		DataMimeType("application/x-protobuf").
+		Data(wrapperspb.String("foobar")).
+		RetrieveFlux().
+		BlockToSlice(context.Background(), &greetings)
+	assert.NoError(t, err, "request failed")
+	assert.Len(t, greetings, 3, "bad result")
+	assert.Equal(t, "hello foobar", greetings[0].GetValue(), "bad result")
+}
+
+func TestServer_CBOR(t *testing.T) {
+	router := messaging.NewRouter()
+	_ = router.Handle("students.v1.upsert", func(c *messaging.RouteContext, s Student) Result {
+		assert.Equal(t, "application/cbor", c.DataMimeType(), "bad data mime type")
+		s.ID = 1234
+		return Result{Data: s}
+	})
+	loopback, stop := serve(t, router)
+	defer stop()
+
+	requester, err := messaging.Builder().
+		DataMimeType("application/cbor").
+		ConnectLoopback(loopback).
+		Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	var result Result
+	err = requester.Route("students.v1.upsert").
+		Data(Student{Name: "foobar", Birth: "2020-04-28"}).
+		RetrieveMono().
+		BlockTo(context.Background(), &result)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, uint64(1234), result.Data.(map[string]interface{})["id"], "bad result")
+	assert.Equal(t, "foobar", result.Data.(map[string]interface{})["name"], "bad result")
+}
+
+func TestServer_Msgpack(t *testing.T) {
+	type tenant struct {
+		Name string `json:"name"`
+	}
+	router := messaging.NewRouter()
+	_ = router.Connect("connect", func(c *messaging.RouteContext) (err error) {
+		var s Student
+		if err = c.BindData(&s); err != nil {
+			return
+		}
+		if s.Name != "foobar" {
+			return errors.Errorf("bad setup data: %s", s)
+		}
+		return
+	})
+	_ = router.Handle("students.v1", func(c *messaging.RouteContext, s Student) (chan Student, error) {
+		var tn tenant
+		if err := c.BindMetadata(messaging.MimeTypeMsgpack, &tn); err != nil {
+			return nil, err
+		}
+		students := make(chan Student, 10)
+		for i := 0; i < 10; i++ {
+			students <- Student{ID: i, Name: tn.Name + "/" + s.Name}
+		}
+		close(students)
+		return students, nil
+	})
+	loopback, stop := serve(t, router)
+	defer stop()
+
+	requester, err := messaging.Builder().
+		DataMimeType(messaging.MimeTypeMsgpack).
+		SetupRoute("connect").
+		SetupData(Student{Name: "foobar"}).
+		ConnectLoopback(loopback).
+		Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	var students []Student
+	err = requester.Route("students.v1").
+		Metadata(tenant{Name: "foo"}, messaging.MimeTypeMsgpack).
+		Data(Student{Name: "bar"}).
+		RetrieveFlux().
+		BlockToSlice(context.Background(), &students)
+	assert.NoError(t, err, "request failed")
+	assert.Len(t, students, 10, "bad result")
+	assert.Equal(t, Student{ID: 9, Name: "foo/bar"}, students[9], "bad result")
+}
+
+func TestServer_Auth(t *testing.T) {
+	const mimeType = "message/x.rsocket.authentication.v0"
+	router := messaging.NewRouter()
+	_ = router.Connect("connect", func(c *messaging.RouteContext) error {
+		auth, _ := c.Metadata(mimeType)
+		if string(auth) != "\x80\x00\x04userpass" {
+			return errors.Errorf("bad setup auth: %q", auth)
+		}
+		return nil
+	})
+	_ = router.Route("auth", func(c *messaging.RouteContext) error {
+		auth, _ := c.Metadata(mimeType)
+		return c.Respond(hex.EncodeToString(auth))
+	})
+	loopback, stop := serve(t, router)
+	defer stop()
+
+	requester, err := messaging.Builder().
+		SetupRoute("connect").
+		SetupAuthSimple("user", "pass").
+		ConnectLoopback(loopback).
+		Build(context.Background())
+	assert.NoError(t, err, "connect failed")
+	defer requester.Close()
+
+	var auth string
+	err = requester.Route("auth").AuthBearer("token").RetrieveMono().BlockTo(context.Background(), &auth)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, hex.EncodeToString([]byte("\x81token")), auth, "bad bearer auth")
+
+	err = requester.Route("auth").Auth("x.custom", []byte("secret")).RetrieveMono().BlockTo(context.Background(), &auth)
+	assert.NoError(t, err, "request failed")
+	assert.Equal(t, hex.EncodeToString([]byte("\x07x.customsecret")), auth, "bad custom auth")
+}
@@ -0,0 +1,84 @@
+package spi
+
+import (
+	"github.com/rsocket/rsocket-go/extension"
+	"github.com/rsocket/rsocket-go/payload"
+	"github.com/rsocket/rsocket-go/rx/flux"
+	"github.com/rsocket/rsocket-go/rx/mono"
+)
+
+// InteractionType is the RSocket interaction model of a request.
+type InteractionType int8
+
+const (
+	FireAndForget InteractionType = iota
+	RequestResponse
+	RequestStream
+	RequestChannel
+)
+
+func (t InteractionType) String() string {
+	switch t {
+	case FireAndForget:
+		return "FireAndForget"
+	case RequestResponse:
+		return "RequestResponse"
+	case RequestStream:
+		return "RequestStream"
+	case RequestChannel:
+		return "RequestChannel"
+	default:
+		return "Unknown"
+	}
+}
+
+// MetadataEntry is an entry of composite metadata.
+type MetadataEntry struct {
+	MimeType string
+	Content  []byte
+}
+
+// Request is an encoded request which can be mutated by interceptors before it's sent.
+// Metadata doesn't contain the routing entry which is built from Route. Data is nil for request-channel, the outbound
+// stream is sent as it is.
+type Request struct {
+	Type     InteractionType
+	Route    string
+	Metadata []MetadataEntry
+	Data     []byte
+}
+
+// Payload encodes the request as a payload with composite metadata.
+func (r *Request) Payload() (payload.Payload, error) {
+	bu := extension.NewCompositeMetadataBuilder()
+	if r.Route != "" {
+		routing, err := extension.EncodeRouting(r.Route)
+		if err != nil {
+			return nil, err
+		}
+		bu.PushWellKnown(extension.MessageRouting, routing)
+	}
+	for _, it := range r.Metadata {
+		bu.Push(it.MimeType, it.Content)
+	}
+	metadata, err := bu.Build()
+	if err != nil {
+		return nil, err
+	}
+	return payload.New(r.Data, metadata), nil
+}
+
+// Response is the result of a request. Mono is set for request-response, Flux is set for request-stream and
+// request-channel, and Err fails the request of any interaction type.
+type Response struct {
+	Mono mono.Mono
+	Flux flux.Flux
+	Err  error
+}
+
+// Invoker sends a request.
+type Invoker = func(req *Request) Response
+
+// Interceptor intercepts requests of a requester. It can mutate the request before calling next, short-circuit by
+// returning a Response without calling next, or wrap the Mono or Flux returned by next.
+type Interceptor = func(req *Request, next Invoker) Response
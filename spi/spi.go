@@ -21,11 +21,24 @@ type Flux interface {
 
 type Requester interface {
 	io.Closer
+	// Route creates a request of the route template like "student.v1.{id}", variables are filled by a map, a struct or
+	// values by order. A template without variables is formatted by fmt.Sprintf.
 	Route(route string, args ...interface{}) RequestSpec
 }
 
 type RequestSpec interface {
 	Metadata(metadata interface{}, mimeType string) RequestSpec
+	// Auth adds a message/x.rsocket.authentication.v0 entry with a custom auth type.
+	Auth(authType string, payload []byte) RequestSpec
+	// AuthSimple adds a message/x.rsocket.authentication.v0 entry with simple auth type.
+	AuthSimple(username, password string) RequestSpec
+	// AuthBearer adds a message/x.rsocket.authentication.v0 entry with bearer auth type.
+	AuthBearer(token string) RequestSpec
+	// DataMimeType overrides the data mime type of current request, it will be sent as message/x.rsocket.mime-type.v0.
+	DataMimeType(mimeType string) RequestSpec
+	// AcceptMimeTypes sets the acceptable response mime types, they will be sent as message/x.rsocket.accept-mime-types.v0.
+	AcceptMimeTypes(mimeTypes ...string) RequestSpec
+	// Data sets the request data, a readable chan or a flux.Flux will be sent as request-channel by RetrieveFlux.
 	Data(data interface{}) RequestSpec
 	RetrieveMono() Mono
 	RetrieveFlux() Flux
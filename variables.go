@@ -0,0 +1,128 @@
+package messaging
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jjeffcaii/rsocket-messaging-go/internal"
+	"github.com/pkg/errors"
+)
+
+const _tagRoute = "route"
+
+var errRequireStructPtr = errors.New("require a struct ptr")
+
+// InvalidArgumentError means a route variable is missing or cannot be converted to the required type.
+type InvalidArgumentError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return fmt.Sprintf("invalid argument %s=%q: %s", e.Name, e.Value, e.Err)
+}
+
+func (e *InvalidArgumentError) Cause() error {
+	return e.Err
+}
+
+func (e *InvalidArgumentError) Unwrap() error {
+	return e.Err
+}
+
+// BindVariable converts the variable into the target, which must be a pointer.
+func (c *RouteContext) BindVariable(name string, to interface{}) error {
+	ptr := reflect.ValueOf(to)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return errors.Errorf("cannot bind variable %s to %T", name, to)
+	}
+	v, err := c.convertVariable(name, ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+	ptr.Elem().Set(v)
+	return nil
+}
+
+// BindVariables fills fields of the struct with variables by the "route" tag.
+//
+//	type StudentKey struct {
+//		ID int64 `route:"id"`
+//	}
+func (c *RouteContext) BindVariables(to interface{}) error {
+	ptr := reflect.ValueOf(to)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct {
+		return errRequireStructPtr
+	}
+	value := ptr.Elem()
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, ok := field.Tag.Lookup(_tagRoute)
+		if !ok || name == "" || name == "-" {
+			continue
+		}
+		if field.PkgPath != "" {
+			return errors.Errorf("cannot bind variable %s to unexported field %s", name, field.Name)
+		}
+		v, err := c.convertVariable(name, field.Type)
+		if err != nil {
+			return err
+		}
+		value.Field(i).Set(v)
+	}
+	return nil
+}
+
+func (c *RouteContext) VariableInt64(name string) (n int64, err error) {
+	err = c.BindVariable(name, &n)
+	return
+}
+
+func (c *RouteContext) VariableUint(name string) (n uint, err error) {
+	err = c.BindVariable(name, &n)
+	return
+}
+
+func (c *RouteContext) VariableBool(name string) (b bool, err error) {
+	err = c.BindVariable(name, &b)
+	return
+}
+
+func (c *RouteContext) VariableFloat64(name string) (f float64, err error) {
+	err = c.BindVariable(name, &f)
+	return
+}
+
+func (c *RouteContext) VariableDuration(name string) (d time.Duration, err error) {
+	err = c.BindVariable(name, &d)
+	return
+}
+
+func (c *RouteContext) VariableUUID(name string) (id uuid.UUID, err error) {
+	err = c.BindVariable(name, &id)
+	return
+}
+
+func (c *RouteContext) convertVariable(name string, typ reflect.Type) (v reflect.Value, err error) {
+	s, ok := c.Variable(name)
+	if !ok {
+		err = &InvalidArgumentError{
+			Name: name,
+			Err:  errors.New("no such variable"),
+		}
+		return
+	}
+	v, err = internal.ConvertString(s, typ)
+	if err != nil {
+		err = &InvalidArgumentError{
+			Name:  name,
+			Value: s,
+			Err:   err,
+		}
+	}
+	return
+}
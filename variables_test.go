@@ -0,0 +1,75 @@
+package messaging_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/jjeffcaii/rsocket-messaging-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteContext_TypedVariables(t *testing.T) {
+	id := uuid.New()
+	router := NewRouter()
+	err := router.Route("students.{id}.{uid}.{active}.{score}.{ttl}.{birth}", func(c *RouteContext) error {
+		n, err := c.VariableInt64("id")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2020), n)
+		u, err := c.VariableUint("id")
+		assert.NoError(t, err)
+		assert.Equal(t, uint(2020), u)
+		uid, err := c.VariableUUID("uid")
+		assert.NoError(t, err)
+		assert.Equal(t, id, uid)
+		b, err := c.VariableBool("active")
+		assert.NoError(t, err)
+		assert.True(t, b)
+		f, err := c.VariableFloat64("score")
+		assert.NoError(t, err)
+		assert.Equal(t, 99.0, f)
+		d, err := c.VariableDuration("ttl")
+		assert.NoError(t, err)
+		assert.Equal(t, 3*time.Second, d)
+		var birth time.Time
+		assert.NoError(t, c.BindVariable("birth", &birth))
+		assert.Equal(t, 2020, birth.Year())
+
+		_, err = c.VariableInt64("uid")
+		var e *InvalidArgumentError
+		assert.True(t, errors.As(err, &e), "should be invalid argument")
+		assert.Equal(t, "uid", e.Name)
+		_, err = c.VariableBool("not_exist")
+		assert.True(t, errors.As(err, &e), "should be invalid argument")
+		return nil
+	})
+	assert.NoError(t, err)
+	err = router.Fire("students.2020." + id.String() + ".true.99.3s.2020-04-28T00:00:00Z")
+	assert.NoError(t, err)
+}
+
+func TestRouteContext_BindVariables(t *testing.T) {
+	type key struct {
+		ID      int64  `route:"id"`
+		Course  string `route:"course"`
+		Version *int   `route:"version"`
+		Ignored string
+	}
+	router := NewRouter()
+	_ = router.Route("students.{id}.courses.{course}.{version}", func(c *RouteContext) (err error) {
+		var k key
+		if err = c.BindVariables(&k); err != nil {
+			return
+		}
+		assert.Equal(t, int64(1), k.ID)
+		assert.Equal(t, "cs", k.Course)
+		assert.Equal(t, 2, *k.Version)
+		return
+	})
+	assert.NoError(t, router.Fire("students.1.courses.cs.2"))
+	err := router.Fire("students.x.courses.cs.2")
+	var e *InvalidArgumentError
+	assert.True(t, errors.As(err, &e), "should be invalid argument")
+	assert.Equal(t, "x", e.Value)
+}